@@ -0,0 +1,243 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 可以单独选择安装的组件
+const (
+	ComponentClient  = "client"
+	ComponentRuntime = "runtime"
+	ComponentData    = "data"
+)
+
+var allComponents = []string{ComponentClient, ComponentRuntime, ComponentData}
+
+// 默认会阻止安装的进程
+var defaultBlockingProcesses = []string{"GamePower.exe", "steam.exe", "steamwebhelper.exe"}
+
+// Answers 应答文件, 提供安装界面上需要用户选择的所有内容, 例如:
+//
+//	{
+//	  "installPath": "%ProgramFiles%\\LuckyGameTools",
+//	  "language": "german",
+//	  "components": ["client", "runtime", "data"],
+//	  "shortcut": false,
+//	  "launch": false,
+//	  "blockingProcesses": ["GamePower.exe", "steam.exe"]
+//	}
+//
+// 字符串中的 %NAME% 会被替换为环境变量. 文件扩展名为 .yaml/.yml 时按 YAML 解析.
+type Answers struct {
+	InstallPath       string
+	Language          string
+	Components        []string
+	Shortcut          *bool
+	Launch            *bool
+	BlockingProcesses []string
+}
+
+type answerKind int
+
+const (
+	answerString answerKind = iota
+	answerBool
+	answerList
+)
+
+// answersSchema 应答文件中允许出现的字段及其类型
+var answersSchema = map[string]answerKind{
+	"installPath":       answerString,
+	"language":          answerString,
+	"components":        answerList,
+	"shortcut":          answerBool,
+	"launch":            answerBool,
+	"blockingProcesses": answerList,
+}
+
+// LoadAnswers 读取并校验应答文件, 一次报告所有有问题的字段
+func LoadAnswers(path string) (*Answers, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]any
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	default:
+		err = json.Unmarshal(data, &raw)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	answers, errs := parseAnswers(raw)
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+	return answers, nil
+}
+
+func parseAnswers(raw map[string]any) (*Answers, []error) {
+	var errs []error
+	fieldError := func(field string, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	answers := &Answers{}
+	for _, key := range keys {
+		kind, ok := answersSchema[key]
+		if !ok {
+			fieldError(key, "unknown field")
+			continue
+		}
+
+		value := raw[key]
+		switch kind {
+		case answerString:
+			s, ok := value.(string)
+			if !ok {
+				fieldError(key, "must be a string")
+				continue
+			}
+			expanded, err := expandEnv(s)
+			if err != nil {
+				fieldError(key, "%v", err)
+				continue
+			}
+			switch key {
+			case "installPath":
+				answers.InstallPath = expanded
+			case "language":
+				answers.Language = expanded
+			}
+		case answerBool:
+			b, ok := value.(bool)
+			if !ok {
+				fieldError(key, "must be true or false")
+				continue
+			}
+			switch key {
+			case "shortcut":
+				answers.Shortcut = &b
+			case "launch":
+				answers.Launch = &b
+			}
+		case answerList:
+			items, ok := value.([]any)
+			if !ok {
+				fieldError(key, "must be a list of strings")
+				continue
+			}
+			// 空列表和没有这个字段不同, 不是 nil
+			list := []string{}
+			for i, item := range items {
+				s, ok := item.(string)
+				if !ok {
+					fieldError(fmt.Sprintf("%s[%d]", key, i), "must be a string")
+					continue
+				}
+				expanded, err := expandEnv(s)
+				if err != nil {
+					fieldError(fmt.Sprintf("%s[%d]", key, i), "%v", err)
+					continue
+				}
+				list = append(list, expanded)
+			}
+			switch key {
+			case "components":
+				answers.Components = list
+			case "blockingProcesses":
+				answers.BlockingProcesses = list
+			}
+		}
+	}
+
+	if answers.InstallPath != "" {
+		if !filepath.IsAbs(answers.InstallPath) {
+			fieldError("installPath", "must be an absolute path: %s", answers.InstallPath)
+		} else {
+			answers.InstallPath = filepath.Clean(answers.InstallPath)
+		}
+	}
+
+	if answers.Language != "" {
+		code := strings.ToLower(answers.Language)
+		if !IsLocaleCode(code) {
+			// 也接受界面上显示的语言名称, 例如 "Deutsch (German)"
+			code = GetLocaleLangsCode(answers.Language)
+			if code == "english" && answers.Language != "English" {
+				fieldError("language", "unknown language: %s", answers.Language)
+			}
+		}
+		answers.Language = code
+	}
+
+	// 类型不对时上面已经报告过, 这里只检查空列表
+	if answers.Components != nil && len(answers.Components) == 0 {
+		fieldError("components", "at least one component is required")
+	}
+	seen := make(map[string]bool)
+	for _, component := range answers.Components {
+		if !isComponent(component) {
+			fieldError("components", "unknown component %q, expected one of %s", component, strings.Join(allComponents, ", "))
+		} else if seen[component] {
+			fieldError("components", "duplicate component %q", component)
+		}
+		seen[component] = true
+	}
+
+	for _, process := range answers.BlockingProcesses {
+		if !strings.HasSuffix(strings.ToLower(process), ".exe") || strings.ContainsAny(process, `\/`) {
+			fieldError("blockingProcesses", "expected an executable name like steam.exe: %s", process)
+		}
+	}
+
+	return answers, errs
+}
+
+func isComponent(name string) bool {
+	for _, component := range allComponents {
+		if component == name {
+			return true
+		}
+	}
+	return false
+}
+
+var envPattern = regexp.MustCompile(`%([^%]+)%`)
+
+// expandEnv 替换 Windows 风格的 %NAME% 环境变量, 未定义的变量视为错误
+func expandEnv(s string) (string, error) {
+	var missing []string
+	expanded := envPattern.ReplaceAllStringFunc(s, func(match string) string {
+		name := match[1 : len(match)-1]
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, match)
+			return match
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("undefined environment variable %s", strings.Join(missing, ", "))
+	}
+	return expanded, nil
+}
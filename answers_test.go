@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestLoadAnswers(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("LGT_TEST_DIR", dir)
+	files := map[string]string{
+		"answers.json": `{
+  "installPath": "%LGT_TEST_DIR%\\LuckyGameTools",
+  "language": "Deutsch (German)",
+  "components": ["client", "runtime"],
+  "shortcut": false,
+  "blockingProcesses": ["%LGT_TEST_EXE%.exe"]
+}`,
+		"answers.yaml": `installPath: '%LGT_TEST_DIR%\LuckyGameTools'
+language: Deutsch (German)
+components: [client, runtime]
+shortcut: false
+blockingProcesses:
+  - '%LGT_TEST_EXE%.exe'
+`,
+	}
+	t.Setenv("LGT_TEST_EXE", "steam")
+	shortcut := false
+	want := &Answers{
+		InstallPath:       filepath.Clean(dir + `\LuckyGameTools`),
+		Language:          "german",
+		Components:        []string{"client", "runtime"},
+		Shortcut:          &shortcut,
+		BlockingProcesses: []string{"steam.exe"},
+	}
+	for name, data := range files {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		got, err := LoadAnswers(path)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %+v, want %+v", name, got, want)
+		}
+	}
+
+	// YAML 语法在 .json 文件中是错误
+	path := filepath.Join(dir, "yaml.json")
+	os.WriteFile(path, []byte(files["answers.yaml"]), 0644)
+	if _, err := LoadAnswers(path); err == nil || !strings.HasPrefix(err.Error(), path+": ") {
+		t.Errorf("LoadAnswers(%s) = %v, want a JSON error", path, err)
+	}
+}
+
+func TestParseAnswersErrors(t *testing.T) {
+	raw := map[string]any{
+		"installPath":       "relative\\path",
+		"language":          "Klingon",
+		"components":        []any{"client", "editor", "client", 3},
+		"shortcut":          "no",
+		"launch":            1,
+		"blockingProcesses": []any{"steam", `C:\x.exe`},
+		"silent":            true,
+	}
+	_, errs := parseAnswers(raw)
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	// 所有有问题的字段一次报告
+	want := []string{
+		"components[3]: must be a string",
+		"launch: must be true or false",
+		"shortcut: must be true or false",
+		"silent: unknown field",
+		`installPath: must be an absolute path: relative\path`,
+		"language: unknown language: Klingon",
+		`components: unknown component "editor", expected one of client, runtime, data`,
+		`components: duplicate component "client"`,
+		"blockingProcesses: expected an executable name like steam.exe: steam",
+		`blockingProcesses: expected an executable name like steam.exe: C:\x.exe`,
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("parseAnswers errors =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	for _, test := range []struct {
+		raw  map[string]any
+		want string
+	}{
+		{map[string]any{"components": []any{}}, "components: at least one component is required"},
+		{map[string]any{"components": "client"}, "components: must be a list of strings"},
+		{map[string]any{"installPath": "%LGT_UNDEFINED%\\x"}, "installPath: undefined environment variable %LGT_UNDEFINED%"},
+		{map[string]any{"blockingProcesses": []any{"%LGT_UNDEFINED%.exe"}}, "blockingProcesses[0]: undefined environment variable %LGT_UNDEFINED%"},
+	} {
+		_, errs := parseAnswers(test.raw)
+		if len(errs) != 1 || errs[0].Error() != test.want {
+			t.Errorf("parseAnswers(%v) = %v, want %s", test.raw, errs, test.want)
+		}
+	}
+}
+
+func TestParseAnswersLanguage(t *testing.T) {
+	for _, test := range []struct {
+		language, want string
+	}{
+		{"german", "german"},
+		{"GERMAN", "german"},
+		{"Deutsch (German)", "german"},
+		{"English", "english"},
+		{"简体中文 (Simplified Chinese)", "schinese"},
+	} {
+		answers, errs := parseAnswers(map[string]any{"language": test.language})
+		if len(errs) > 0 || answers.Language != test.want {
+			t.Errorf("language %q = %q, %v, want %s", test.language, answers.Language, errs, test.want)
+		}
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	t.Setenv("LGT_A", "a")
+	t.Setenv("LGT_EMPTY", "")
+	for _, test := range []struct {
+		in, want, err string
+	}{
+		{"%LGT_A%\\%LGT_A%", "a\\a", ""},
+		{"%LGT_EMPTY%x", "x", ""},
+		{"100%", "100%", ""},
+		{"no variables", "no variables", ""},
+		{"%LGT_MISSING%\\%LGT_A%\\%LGT_OTHER%", "", "undefined environment variable %LGT_MISSING%, %LGT_OTHER%"},
+	} {
+		got, err := expandEnv(test.in)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("expandEnv(%q) = %q, %v, want error %s", test.in, got, err, test.err)
+			}
+			continue
+		}
+		if err != nil || got != test.want {
+			t.Errorf("expandEnv(%q) = %q, %v, want %q", test.in, got, err, test.want)
+		}
+	}
+}
+
+func TestApplyAnswers(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "answers.json")
+	data := `{"installPath": "` + filepath.ToSlash(filepath.Join(dir, "FromFile")) + `", "language": "german", "shortcut": false, "launch": false}`
+	if err := os.WriteFile(config, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 命令行参数优先于应答文件
+	flagPath := filepath.Join(dir, "FromFlag")
+	opts, err := parseOptions([]string{"--config", config, "--path", flagPath, "--lang", "french"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Path != flagPath || opts.Lang != "french" || !opts.NoShortcut || !opts.NoLaunch {
+		t.Errorf("got %+v, want path and language from the flags, shortcut and launch from the file", opts)
+	}
+	opts, err = parseOptions([]string{"--config", config})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.Path != filepath.Join(dir, "FromFile") || opts.Lang != "german" {
+		t.Errorf("got %+v, want path and language from the file", opts)
+	}
+
+	// blockingProcesses: [] 不检查任何进程, 没有这个字段时使用默认值
+	for _, test := range []struct {
+		raw  map[string]any
+		want []string
+	}{
+		{map[string]any{"blockingProcesses": []any{}}, []string{}},
+		{map[string]any{}, defaultBlockingProcesses},
+		{map[string]any{"blockingProcesses": []any{"x.exe"}}, []string{"x.exe"}},
+	} {
+		answers, errs := parseAnswers(test.raw)
+		if len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		opts := &Options{}
+		opts.applyAnswers(answers, nil)
+		ic := &InstallContext{Components: allComponents, BlockingProcesses: defaultBlockingProcesses}
+		opts.apply(ic)
+		if ic.BlockingProcesses == nil || !slices.Equal(ic.BlockingProcesses, test.want) {
+			t.Errorf("blockingProcesses %v: got %q, want %q", test.raw, ic.BlockingProcesses, test.want)
+		}
+		if !slices.Equal(ic.Components, allComponents) {
+			t.Errorf("components %v: got %q, want all", test.raw, ic.Components)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+// Options 命令行参数, 例如:
+//
+//	LuckyGameToolsInstaller.exe --silent --path=D:\Tools\LuckyGameTools --lang=german --no-launch --no-shortcut
+//
+// --config 指定的应答文件可以提供同样的内容, 命令行参数优先.
+type Options struct {
+	Silent     bool
+	Path       string
+	Lang       string
+	NoLaunch   bool
+	NoShortcut bool
+	Config     string
+	ResultFile string
+	Uninstall  bool
+	Purge      bool
+	Repair     bool
+	Timeout    time.Duration
+	LogLevel   string
+	LogFile    string
+	NoRedact   bool
+
+	// 以下只能由应答文件提供, 为空时使用默认值
+	Components        []string
+	BlockingProcesses []string
+}
+
+func parseOptions(args []string) (*Options, error) {
+	opts := &Options{}
+	fs := flag.NewFlagSet("LuckyGameToolsInstaller", flag.ContinueOnError)
+	fs.BoolVar(&opts.Silent, "silent", false, "install without any window")
+	fs.StringVar(&opts.Path, "path", "", "install directory")
+	fs.StringVar(&opts.Lang, "lang", "", "language code, e.g. german, schinese")
+	fs.BoolVar(&opts.NoLaunch, "no-launch", false, "do not start LuckyGameTools after installation")
+	fs.BoolVar(&opts.NoShortcut, "no-shortcut", false, "do not create the desktop shortcut")
+	fs.StringVar(&opts.Config, "config", "", "answer file (.json, .yaml) with the install settings")
+	fs.StringVar(&opts.ResultFile, "result-file", "", "write the install result as JSON to this file")
+	fs.BoolVar(&opts.Uninstall, "uninstall", false, "remove the files recorded by the last installation")
+	fs.BoolVar(&opts.Purge, "purge", false, "with --uninstall, also remove the webcache and user data")
+	fs.BoolVar(&opts.Repair, "repair", false, "restore installed files that are missing or damaged")
+	fs.DurationVar(&opts.Timeout, "timeout", 0, "cancel and roll back if not finished within this duration, e.g. 10m")
+	fs.StringVar(&opts.LogLevel, "log-level", "info", "log level: debug, info, warn or error")
+	fs.StringVar(&opts.LogFile, "log-file", "", "write the log to this file instead of %APPDATA%\\luckygametools\\installer.log")
+	fs.BoolVar(&opts.NoRedact, "no-redact", false, "keep the user name, profile folder name and computer name in the log")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		err := fmt.Errorf("unexpected argument: %s", fs.Arg(0))
+		fmt.Fprintln(fs.Output(), err)
+		return nil, err
+	}
+
+	if opts.Repair && opts.Uninstall {
+		err := errors.New("--repair and --uninstall cannot be used together")
+		fmt.Fprintln(fs.Output(), err)
+		return nil, err
+	}
+	if opts.Timeout < 0 {
+		err := errors.New("--timeout must not be negative")
+		fmt.Fprintln(fs.Output(), err)
+		return nil, err
+	}
+	if _, err := parseLogLevel(opts.LogLevel); err != nil {
+		fmt.Fprintln(fs.Output(), err)
+		return nil, err
+	}
+	if opts.Purge && !opts.Uninstall {
+		err := errors.New("--purge requires --uninstall")
+		fmt.Fprintln(fs.Output(), err)
+		return nil, err
+	}
+
+	if opts.Config != "" {
+		answers, err := LoadAnswers(opts.Config)
+		if err != nil {
+			fmt.Fprintln(fs.Output(), err)
+			return nil, err
+		}
+		set := make(map[string]bool)
+		fs.Visit(func(f *flag.Flag) {
+			set[f.Name] = true
+		})
+		opts.applyAnswers(answers, set)
+	}
+
+	if opts.Lang != "" {
+		opts.Lang = strings.ToLower(opts.Lang)
+		if !IsLocaleCode(opts.Lang) {
+			err := fmt.Errorf("unknown language: %s", opts.Lang)
+			fmt.Fprintln(fs.Output(), err)
+			return nil, err
+		}
+	}
+	if opts.Path != "" {
+		path, err := filepath.Abs(opts.Path)
+		if err != nil {
+			fmt.Fprintln(fs.Output(), err)
+			return nil, err
+		}
+		opts.Path = path
+	}
+	return opts, nil
+}
+
+// applyAnswers 用应答文件填充命令行没有指定的参数
+func (opts *Options) applyAnswers(answers *Answers, set map[string]bool) {
+	if !set["path"] && answers.InstallPath != "" {
+		opts.Path = answers.InstallPath
+	}
+	if !set["lang"] && answers.Language != "" {
+		opts.Lang = answers.Language
+	}
+	if !set["no-shortcut"] && answers.Shortcut != nil {
+		opts.NoShortcut = !*answers.Shortcut
+	}
+	if !set["no-launch"] && answers.Launch != nil {
+		opts.NoLaunch = !*answers.Launch
+	}
+	opts.Components = answers.Components
+	opts.BlockingProcesses = answers.BlockingProcesses
+}
+
+// apply 把参数应用到安装上下文
+func (opts *Options) apply(ic *InstallContext) {
+	ic.NoShortcut = opts.NoShortcut
+	ic.NoLaunch = opts.NoLaunch
+	// nil 表示应答文件没有指定, 使用默认值; blockingProcesses: [] 表示不检查任何进程
+	if opts.Components != nil {
+		ic.Components = opts.Components
+	}
+	if opts.BlockingProcesses != nil {
+		ic.BlockingProcesses = opts.BlockingProcesses
+	}
+}
+
+// context 返回安装用的 context, 指定了 --timeout 时到时间后以 ErrTimeout 取消
+func (opts *Options) context() (context.Context, context.CancelFunc) {
+	if opts.Timeout > 0 {
+		return context.WithTimeoutCause(context.Background(), opts.Timeout, ErrTimeout)
+	}
+	return context.WithCancel(context.Background())
+}
+
+// runSilent 不创建任何窗口执行安装, 返回进程退出码
+func runSilent(opts *Options) int {
+	start := time.Now()
+	if opts.Lang != "" {
+		i18n = InitI18n(opts.Lang)
+	} else {
+		i18n = InitI18n(GetLocale())
+	}
+
+	installPath := opts.Path
+	if installPath == "" {
+		installPath = defaultInstallPath()
+	}
+
+	var warnings []*StepError
+	err := func() error {
+		// 静默模式没法询问用户, 上次被中断的安装总是回滚
+		journal, err := LoadJournal(JournalPath())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		} else if journal != nil {
+			if err := rollbackInterruptedInstall(journal); err != nil {
+				return err
+			}
+		}
+
+		ctx, cancel := opts.context()
+		defer cancel()
+		ic := newInstallContext(installPath, i18n)
+		opts.apply(ic)
+		ic.Context = ctx
+		warnings, err = installProgram(ic, nil)
+		return err
+	}()
+
+	if err != nil {
+		var elevate *elevateError
+		if errors.As(err, &elevate) && !IsAdmin() {
+			// 管理员进程会自己写结果文件
+			code, adminErr := runAsAdminWait(os.Args[1:])
+			if adminErr == nil {
+				return int(code)
+			}
+			err = errors.Join(adminErr, err)
+		}
+	}
+
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, warning)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	result := newInstallResult(installPath, start, err, warnings)
+	if err := result.Write(opts.ResultFile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return result.ExitCode
+}
+
+// pathFlags 值是文件或目录的参数
+var pathFlags = map[string]bool{"path": true, "config": true, "result-file": true, "log-file": true}
+
+// absArgs 把参数中的相对路径转为绝对路径. 以管理员权限启动的进程工作目录是 System32,
+// 相对路径在新进程中会指向别的地方
+func absArgs(args []string) []string {
+	result := make([]string, len(args))
+	copy(result, args)
+	for i := 0; i < len(result); i++ {
+		arg := result[i]
+		if arg == "--" || !strings.HasPrefix(arg, "-") {
+			break
+		}
+		name := strings.TrimLeft(arg, "-")
+		name, value, hasValue := strings.Cut(name, "=")
+		if !pathFlags[name] {
+			continue
+		}
+		if !hasValue {
+			// -path D:\Tools 的形式, 值是下一个参数
+			if i+1 >= len(result) {
+				break
+			}
+			i++
+			value = result[i]
+		}
+		if value == "" {
+			continue
+		}
+		abs, err := filepath.Abs(value)
+		if err != nil {
+			continue
+		}
+		if hasValue {
+			result[i] = arg[:len(arg)-len(value)] + abs
+		} else {
+			result[i] = abs
+		}
+	}
+	return result
+}
+
+// flagValue 在参数中查找 name 的值, 用于 parseOptions 失败时仍然找到 --result-file, 没有时返回空字符串.
+// 不知道哪些参数带值, 所以跳过不以 - 开头的参数继续找, 例如 --timeout soon --result-file r.json
+func flagValue(args []string, name string) string {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+		if !strings.HasPrefix(arg, "-") {
+			continue
+		}
+		flagName, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if flagName != name {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// joinArgs 把参数拼成 Windows 命令行
+func joinArgs(args []string) string {
+	escaped := make([]string, len(args))
+	for i, arg := range args {
+		escaped[i] = windows.EscapeArg(arg)
+	}
+	return strings.Join(escaped, " ")
+}
+
+var (
+	shell32            = syscall.NewLazyDLL("shell32.dll")
+	shellExecuteExW    = shell32.NewProc("ShellExecuteExW")
+	seeMaskNoCloseProc = uint32(0x00000040) // SEE_MASK_NOCLOSEPROCESS
+)
+
+// SHELLEXECUTEINFOW
+type shellExecuteInfo struct {
+	cbSize       uint32
+	fMask        uint32
+	hwnd         uintptr
+	lpVerb       *uint16
+	lpFile       *uint16
+	lpParameters *uint16
+	lpDirectory  *uint16
+	nShow        int32
+	hInstApp     uintptr
+	lpIDList     uintptr
+	lpClass      *uint16
+	hkeyClass    uintptr
+	dwHotKey     uint32
+	hIcon        uintptr
+	hProcess     windows.Handle
+}
+
+// runAsAdminWait 以管理员权限重新运行自己并等待结束, 返回新进程的退出码. 参数中的相对路径按当前目录转为绝对路径
+func runAsAdminWait(args []string) (uint32, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+
+	verb, _ := syscall.UTF16PtrFromString("runas")
+	file, _ := syscall.UTF16PtrFromString(exePath)
+	params, _ := syscall.UTF16PtrFromString(joinArgs(absArgs(args)))
+	var dir *uint16
+	if wd, err := os.Getwd(); err == nil {
+		dir, _ = syscall.UTF16PtrFromString(wd)
+	}
+	info := shellExecuteInfo{
+		fMask:        seeMaskNoCloseProc,
+		lpVerb:       verb,
+		lpFile:       file,
+		lpParameters: params,
+		lpDirectory:  dir,
+		nShow:        windows.SW_HIDE,
+	}
+	info.cbSize = uint32(unsafe.Sizeof(info))
+
+	ret, _, err := shellExecuteExW.Call(uintptr(unsafe.Pointer(&info)))
+	if ret == 0 {
+		return 0, err
+	}
+	defer windows.CloseHandle(info.hProcess)
+
+	if _, err := windows.WaitForSingleObject(info.hProcess, windows.INFINITE); err != nil {
+		return 0, err
+	}
+	var code uint32
+	if err := windows.GetExitCodeProcess(info.hProcess, &code); err != nil {
+		return 0, err
+	}
+	return code, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOptions(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts, err := parseOptions([]string{"--silent", "--path", "LuckyGameTools", "--lang=GERMAN", "--timeout", "90s", "--no-launch"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 相对路径按当前目录转为绝对路径, 语言代码不区分大小写
+	if opts.Path != filepath.Join(wd, "LuckyGameTools") || opts.Lang != "german" || opts.Timeout != 90*time.Second || !opts.Silent || !opts.NoLaunch {
+		t.Errorf("got %+v", opts)
+	}
+	if opts.LogLevel != "info" || opts.Components != nil || opts.BlockingProcesses != nil {
+		t.Errorf("defaults = %+v", opts)
+	}
+
+	opts, err = parseOptions([]string{"--uninstall", "--purge"})
+	if err != nil || !opts.Uninstall || !opts.Purge {
+		t.Errorf("--uninstall --purge = %+v, %v", opts, err)
+	}
+}
+
+func TestParseOptionsErrors(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--lang", "klingon"}, "unknown language: klingon"},
+		{[]string{"--timeout", "ten minutes"}, `invalid value "ten minutes" for flag -timeout`},
+		{[]string{"--timeout=-1s"}, "--timeout must not be negative"},
+		{[]string{"--purge"}, "--purge requires --uninstall"},
+		{[]string{"--repair", "--uninstall"}, "--repair and --uninstall cannot be used together"},
+		{[]string{"--log-level", "loud"}, "loud"},
+		{[]string{"--no-such-flag"}, "flag provided but not defined: -no-such-flag"},
+		{[]string{"--silent", "extra"}, "unexpected argument: extra"},
+		{[]string{"--config", filepath.Join(t.TempDir(), "missing.json")}, "missing.json"},
+	}
+	for _, test := range tests {
+		opts, err := parseOptions(test.args)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("parseOptions(%q) = %+v, %v, want error containing %q", test.args, opts, err, test.want)
+		}
+	}
+}
+
+func TestAbsArgs(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abs := func(name string) string { return filepath.Join(wd, name) }
+	dir := t.TempDir()
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{[]string{"--path", "x", "--silent"}, []string{"--path", abs("x"), "--silent"}},
+		{[]string{"--path=x", "-config=a.json"}, []string{"--path=" + abs("x"), "-config=" + abs("a.json")}},
+		{[]string{"--result-file", "r.json", "--log-file=l.log"}, []string{"--result-file", abs("r.json"), "--log-file=" + abs("l.log")}},
+		// 已经是绝对路径的不变, 其他参数不变
+		{[]string{"--path", dir, "--lang", "x"}, []string{"--path", dir, "--lang", "x"}},
+		{[]string{"--path="}, []string{"--path="}},
+		{[]string{"--path"}, []string{"--path"}},
+		// 第一个不是参数的值之后不再处理
+		{[]string{"--silent", "x", "--path", "y"}, []string{"--silent", "x", "--path", "y"}},
+		{[]string{"--", "--path", "y"}, []string{"--", "--path", "y"}},
+	}
+	for _, test := range tests {
+		args := slices.Clone(test.args)
+		if got := absArgs(args); !slices.Equal(got, test.want) {
+			t.Errorf("absArgs(%q) = %q, want %q", test.args, got, test.want)
+		}
+		if !slices.Equal(args, test.args) {
+			t.Errorf("absArgs(%q) modified its argument", test.args)
+		}
+	}
+}
+
+func TestFlagValue(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"--result-file", "r.json"}, "r.json"},
+		{[]string{"-result-file=r.json"}, "r.json"},
+		{[]string{"--timeout=x", "--result-file", "r.json"}, "r.json"},
+		{[]string{"--result-file"}, ""},
+		{[]string{"--silent"}, ""},
+		{[]string{"x", "--result-file", "r.json"}, "r.json"},
+		{[]string{"--", "--result-file", "r.json"}, ""},
+	}
+	for _, test := range tests {
+		if got := flagValue(test.args, "result-file"); got != test.want {
+			t.Errorf("flagValue(%q) = %q, want %q", test.args, got, test.want)
+		}
+	}
+}
+
+// TestUsageResult 参数有错时 main 仍然写出结果文件, 无论 --result-file 在出错的参数之前还是之后
+func TestUsageResult(t *testing.T) {
+	dir := t.TempDir()
+	for i, args := range [][]string{
+		{"--result-file", filepath.Join(dir, "before.json"), "--timeout", "soon"},
+		{"--timeout", "soon", "--result-file", filepath.Join(dir, "after.json")},
+		{"--result-file=" + filepath.Join(dir, "answers.json"), "--purge"},
+	} {
+		_, err := parseOptions(args)
+		if err == nil {
+			t.Fatalf("parseOptions(%q) succeeded", args)
+		}
+		path := flagValue(args, "result-file")
+		if err := newUsageResult(err).Write(path); err != nil {
+			t.Fatal(err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		var result struct {
+			Status   string `json:"status"`
+			ExitCode int    `json:"exitCode"`
+			Error    struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := json.Unmarshal(data, &result); err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != "invalid_arguments" || result.ExitCode != ExitUsage || result.Error.Message == "" {
+			t.Errorf("%q: result = %+v, want invalid_arguments with exit code 2", args, result)
+		}
+	}
+}
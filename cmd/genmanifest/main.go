@@ -0,0 +1,216 @@
+// genmanifest 为安装程序内嵌的压缩包生成清单, 由仓库根目录的 go generate 调用:
+//
+//	go run ./cmd/genmanifest -o exe/manifest.json \
+//		-payload cef/cef84-min.7z:runtime:install \
+//		-payload exe/appdata.zip:data:appdata:hid.dat.xor=hid.dat \
+//		-blob exe/defaultConfig.dat.local
+//
+// -payload 的格式为 <路径>:<组件>:<根目录>[:<压缩包中的路径>=<安装路径>,...],
+// 根目录是 install 或 appdata. 清单中压缩包的顺序和参数顺序一致.
+// -blob 是不需要解压的内嵌文件, 只记录大小和 SHA-256, 用于启动时自检.
+//
+// 清单用 -key 指定的 Ed25519 私钥签名, 签名写到 <输出文件>.sig. 私钥不要提交到仓库,
+// 用 -genkey 生成新的密钥对, 并把打印出的公钥填到 payload.go 的 manifestPublicKey:
+//
+//	go run ./cmd/genmanifest -genkey manifest.key
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+
+	"luckygametools/internal/manifest"
+)
+
+type payloadSpec struct {
+	path      string
+	component string
+	root      string
+	renameMap map[string]string
+}
+
+type payloadFlags []payloadSpec
+
+func (f *payloadFlags) String() string {
+	return fmt.Sprint(len(*f), " payloads")
+}
+
+func (f *payloadFlags) Set(value string) error {
+	parts := strings.SplitN(value, ":", 4)
+	if len(parts) < 3 {
+		return fmt.Errorf("expected <path>:<component>:<root>[:<name>=<target>,...], got %q", value)
+	}
+	spec := payloadSpec{path: parts[0], component: parts[1], root: parts[2], renameMap: make(map[string]string)}
+	if len(parts) == 4 {
+		for _, rename := range strings.Split(parts[3], ",") {
+			name, target, ok := strings.Cut(rename, "=")
+			if !ok {
+				return fmt.Errorf("expected <name>=<target>, got %q", rename)
+			}
+			spec.renameMap[name] = target
+		}
+	}
+	*f = append(*f, spec)
+	return nil
+}
+
+type blobFlags []string
+
+func (f *blobFlags) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *blobFlags) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+func main() {
+	output := flag.String("o", "exe/manifest.json", "output file")
+	var specs payloadFlags
+	flag.Var(&specs, "payload", "<path>:<component>:<root>[:<name>=<target>,...], may be repeated")
+	var blobs blobFlags
+	flag.Var(&blobs, "blob", "embedded file that is not an archive, may be repeated")
+	keyPath := flag.String("key", "", "Ed25519 private key used to sign the manifest")
+	genKey := flag.String("genkey", "", "write a new private key to this file, print the public key and exit")
+	flag.Parse()
+
+	if *genKey != "" {
+		private, public, err := manifest.GenerateKey()
+		if err == nil {
+			err = os.WriteFile(*genKey, []byte(private+"\n"), 0600)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "genmanifest:", err)
+			os.Exit(1)
+		}
+		fmt.Println("public key:", public)
+		return
+	}
+	if *keyPath == "" {
+		fmt.Fprintln(os.Stderr, "genmanifest: -key is required, set LGT_MANIFEST_KEY to the private key file")
+		os.Exit(1)
+	}
+	key, err := manifest.LoadPrivateKey(*keyPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "genmanifest:", err)
+		os.Exit(1)
+	}
+
+	m := &manifest.Manifest{}
+	for _, spec := range specs {
+		payload, err := describe(spec)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "genmanifest:", err)
+			os.Exit(1)
+		}
+		m.Payloads = append(m.Payloads, *payload)
+	}
+	for _, path := range blobs {
+		size, sum, err := manifest.SumFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "genmanifest:", err)
+			os.Exit(1)
+		}
+		m.Blobs = append(m.Blobs, manifest.Blob{Path: filepath.ToSlash(path), Size: size, SHA256: sum})
+	}
+	if err := m.Validate(); err != nil {
+		fmt.Fprintln(os.Stderr, "genmanifest:", err)
+		os.Exit(1)
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "genmanifest:", err)
+		os.Exit(1)
+	}
+	data = append(data, '\n')
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "genmanifest:", err)
+		os.Exit(1)
+	}
+	if err := os.WriteFile(*output+".sig", manifest.Sign(data, key), 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "genmanifest:", err)
+		os.Exit(1)
+	}
+}
+
+// describe 读取一个压缩包, 计算压缩包本身和其中每个文件的 SHA-256
+func describe(spec payloadSpec) (*manifest.Payload, error) {
+	size, sum, err := manifest.SumFile(spec.path)
+	if err != nil {
+		return nil, err
+	}
+	payload := &manifest.Payload{
+		Path:      filepath.ToSlash(spec.path),
+		Format:    manifest.FormatZip,
+		Component: spec.component,
+		Root:      spec.root,
+		Size:      size,
+		SHA256:    sum,
+	}
+
+	add := func(name string, open func() (io.ReadCloser, error)) error {
+		rc, err := open()
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", spec.path, name, err)
+		}
+		defer rc.Close()
+		size, sum, err := manifest.Sum(rc)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", spec.path, name, err)
+		}
+		target := name
+		if rename, ok := spec.renameMap[name]; ok {
+			target = rename
+			delete(spec.renameMap, name)
+		}
+		payload.Files = append(payload.Files, manifest.File{Name: name, Target: target, Size: size, SHA256: sum})
+		return nil
+	}
+
+	if strings.EqualFold(filepath.Ext(spec.path), ".7z") {
+		payload.Format = manifest.Format7z
+		r, err := sevenzip.OpenReader(spec.path)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if err := add(strings.ReplaceAll(f.Name, `\`, "/"), f.Open); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		r, err := zip.OpenReader(spec.path)
+		if err != nil {
+			return nil, err
+		}
+		defer r.Close()
+		for _, f := range r.File {
+			if f.FileInfo().IsDir() {
+				continue
+			}
+			if err := add(f.Name, f.Open); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// 改名的文件必须存在, 防止压缩包更新后改名悄悄失效
+	for name := range spec.renameMap {
+		return nil, fmt.Errorf("%s: %s: no such file to rename", spec.path, name)
+	}
+	return payload, nil
+}
@@ -0,0 +1,215 @@
+// i18n 维护 i18n 目录下的翻译文件, 在仓库根目录运行:
+//
+//	go run ./cmd/i18n extract
+//
+// extract 找出 Go 源码中所有传给 Text、Textf、TextParams 和 TextKey 的字符串常量, 按字母顺序写到 i18n/english.txt,
+// 然后对照检查其他语言的翻译文件, 列出每个文件缺少的、没有用到的和重复的键, 语法错误以及和英文原文不一致的占位符.
+// 有文件缺少翻译、有重复的键、语法错误或占位符错误时以退出码 1 结束, 发布前运行它可以避免带着没有翻译的文字发布.
+// 没有用到的键只是提示, 不影响退出码.
+//
+// -n 只检查, 不写 english.txt, english.txt 和源码不一致时也以退出码 1 结束.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"luckygametools/internal/catalog"
+)
+
+// translateFuncs 第一个参数是翻译键的函数
+var translateFuncs = map[string]bool{
+	"Text":       true,
+	"TextParams": true,
+	"Textf":      true,
+	"TextKey":    true,
+}
+
+const englishFile = "english.txt"
+
+const englishHeader = `# Generated by "go run ./cmd/i18n extract" from the Text, Textf, TextParams and TextKey calls, do not edit.
+# Each line is a key; English shows the key itself.
+`
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: go run ./cmd/i18n extract [-src dir] [-dir dir] [-n]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] != "extract" {
+		usage()
+	}
+	fs := flag.NewFlagSet("extract", flag.ExitOnError)
+	src := fs.String("src", ".", "directory with the Go sources of the installer")
+	dir := fs.String("dir", "i18n", "directory with the translation files")
+	dryRun := fs.Bool("n", false, "only check, do not write "+englishFile)
+	fs.Parse(os.Args[2:])
+	if fs.NArg() > 0 {
+		usage()
+	}
+
+	keys, err := extractKeys(*src)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "i18n:", err)
+		os.Exit(1)
+	}
+	failed := false
+
+	english := formatEnglish(keys)
+	englishPath := filepath.Join(*dir, englishFile)
+	if *dryRun {
+		current, err := os.ReadFile(englishPath)
+		if err != nil || !bytes.Equal(current, english) {
+			fmt.Printf("%s: out of date, run go run ./cmd/i18n extract\n", englishPath)
+			failed = true
+		}
+	} else if err := os.WriteFile(englishPath, english, 0644); err != nil {
+		fmt.Fprintln(os.Stderr, "i18n:", err)
+		os.Exit(1)
+	} else {
+		fmt.Printf("%s: %d keys\n", englishPath, len(keys))
+	}
+
+	files, err := filepath.Glob(filepath.Join(*dir, "*.txt"))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "i18n:", err)
+		os.Exit(1)
+	}
+	for _, path := range files {
+		if filepath.Base(path) == englishFile {
+			continue
+		}
+		if !checkTranslation(path, keys) {
+			failed = true
+		}
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// extractKeys 返回 dir 中的 Go 源码用到的翻译键和第一次出现的位置, 不包括子目录和测试文件
+func extractKeys(dir string) (map[string]token.Position, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	fset := token.NewFileSet()
+	keys := make(map[string]token.Position)
+	for _, path := range paths {
+		if strings.HasSuffix(path, "_test.go") {
+			continue
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.SkipObjectResolution)
+		if err != nil {
+			return nil, err
+		}
+		ast.Inspect(file, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok || len(call.Args) == 0 {
+				return true
+			}
+			fn, ok := call.Fun.(*ast.Ident)
+			if !ok || !translateFuncs[fn.Name] {
+				return true
+			}
+			lit, ok := call.Args[0].(*ast.BasicLit)
+			if !ok || lit.Kind != token.STRING {
+				return true
+			}
+			key, err := strconv.Unquote(lit.Value)
+			if err != nil {
+				return true
+			}
+			if _, ok := keys[key]; !ok {
+				keys[key] = fset.Position(lit.Pos())
+			}
+			return true
+		})
+	}
+	return keys, nil
+}
+
+// formatEnglish 生成 english.txt 的内容, 键按字母顺序排列
+func formatEnglish(keys map[string]token.Position) []byte {
+	var b bytes.Buffer
+	b.WriteString(englishHeader)
+	for _, key := range sortedKeys(keys) {
+		b.WriteString(catalog.Escape(key))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// checkTranslation 打印 path 中缺少的、没有用到的和重复的键以及错误, 没有缺少的键和错误时返回 true
+func checkTranslation(path string, keys map[string]token.Position) bool {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "i18n:", err)
+		return false
+	}
+	name := filepath.Base(path)
+	translations, parseErr := catalog.Parse(name, data)
+
+	// 和 Text 一样, 找不到键时也查找小写的键
+	var missing []string
+	for _, key := range sortedKeys(keys) {
+		if _, ok := translations.Lookup(key); ok {
+			continue
+		}
+		if _, ok := translations.Lookup(strings.ToLower(key)); ok {
+			continue
+		}
+		missing = append(missing, key)
+	}
+	used := make(map[string]bool, len(keys)*2)
+	for key := range keys {
+		used[key] = true
+		used[strings.ToLower(key)] = true
+	}
+	var unused []string
+	for _, entry := range translations.Entries {
+		if !used[entry.Key] {
+			unused = append(unused, entry.Key)
+		}
+	}
+
+	placeholderErr := translations.CheckPlaceholders()
+
+	fmt.Printf("%s: %d missing, %d unused, %d duplicates\n", name, len(missing), len(unused), len(translations.Duplicates))
+	for _, key := range missing {
+		fmt.Printf("  missing: %q (%s)\n", key, keys[key])
+	}
+	for _, key := range unused {
+		fmt.Printf("  unused: %q\n", key)
+	}
+	// 重复的键也在 parseErr 中, 带有行号
+	for _, err := range []error{parseErr, placeholderErr} {
+		if err == nil {
+			continue
+		}
+		for _, line := range strings.Split(err.Error(), "\n") {
+			fmt.Printf("  %s\n", line)
+		}
+	}
+	return len(missing) == 0 && parseErr == nil && placeholderErr == nil
+}
+
+func sortedKeys(keys map[string]token.Position) []string {
+	sorted := make([]string, 0, len(keys))
+	for key := range keys {
+		sorted = append(sorted, key)
+	}
+	slices.Sort(sorted)
+	return sorted
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"luckygametools/internal/safepath"
+)
+
+// ErrorCode 安装错误代码, 显示给用户, 用于查询支持文档.
+// 已发布的代码不要改变含义, 新错误请使用新代码.
+type ErrorCode string
+
+const (
+	CodeProcessRunning ErrorCode = "LGT-1001"
+	CodeClientRunning  ErrorCode = "LGT-1002"
+	CodeRepairBlocked  ErrorCode = "LGT-1003"
+	CodeCreateDir      ErrorCode = "LGT-2001"
+	CodeCopyFile       ErrorCode = "LGT-2002"
+	CodeExtract        ErrorCode = "LGT-3001"
+	CodeExtract7z      ErrorCode = "LGT-3002"
+	CodeVerify         ErrorCode = "LGT-3003"
+	CodeManifest       ErrorCode = "LGT-3004"
+	CodeCorrupted      ErrorCode = "LGT-3005"
+	CodeSignature      ErrorCode = "LGT-3006"
+	CodeExtractLimit   ErrorCode = "LGT-3007"
+	CodeShortcut       ErrorCode = "LGT-4001"
+	CodeLaunch         ErrorCode = "LGT-4002"
+	CodeNotInstalled   ErrorCode = "LGT-5001"
+	CodeRemoveFile     ErrorCode = "LGT-5002"
+	CodeUninstall      ErrorCode = "LGT-5003"
+)
+
+// ErrBlocked 有阻止安装的进程正在运行
+var ErrBlocked = errors.New("blocked by a running process")
+
+// ErrUnsafePath 压缩包中的路径会写到目标目录之外
+var ErrUnsafePath = safepath.ErrUnsafe
+
+// UnsafePathError 压缩包中的路径是绝对路径、带盘符或 UNC 前缀、是设备名, 或者通过 .. 跳出目标目录
+type UnsafePathError = safepath.Error
+
+// ErrLimit 压缩包超出了解压限制
+var ErrLimit = errors.New("archive exceeds extraction limits")
+
+// LimitError 压缩包中的文件超出了 ExtractLimits 中的某个限制, Limit 是限制的名字.
+// 限制针对整个压缩包时 Name 为空
+type LimitError struct {
+	Name  string
+	Limit string
+	Value int64
+	Max   int64
+}
+
+func (e *LimitError) Error() string {
+	if e.Name == "" {
+		return fmt.Sprintf("%s %d exceeds %d", e.Limit, e.Value, e.Max)
+	}
+	return fmt.Sprintf("%s: %s %d exceeds %d", e.Name, e.Limit, e.Value, e.Max)
+}
+
+func (e *LimitError) Unwrap() error {
+	return ErrLimit
+}
+
+var hintRunAsAdmin = TextKey("You can try running with administrator privileges by right clicking")
+
+// errorDef 错误代码对应的翻译模板, 用 TextKey 标记, 模板中的 {file} {dir} {process} {reason} 会被替换
+type errorDef struct {
+	message string
+	hint    string
+	kind    error
+}
+
+var errorDefs = map[ErrorCode]errorDef{
+	CodeProcessRunning: {message: TextKey("Please exit {process} before installing"), kind: ErrBlocked},
+	CodeCreateDir:      {message: TextKey("Could not create {dir}: {reason}"), hint: hintRunAsAdmin, kind: ErrCopy},
+	CodeCopyFile:       {message: TextKey("Could not copy {file}: {reason}"), hint: hintRunAsAdmin, kind: ErrCopy},
+	CodeExtract:        {message: TextKey("Could not extract {file}: {reason}"), hint: hintRunAsAdmin, kind: ErrExtract},
+	CodeExtract7z:      {message: TextKey("Could not extract {file}: {reason}"), hint: hintRunAsAdmin, kind: ErrExtract},
+	CodeVerify:         {message: TextKey("{file} is damaged after extraction: {reason}"), kind: ErrExtract},
+	CodeManifest:       {message: TextKey("The installer payload list is invalid: {reason}"), kind: ErrExtract},
+	CodeCorrupted:      {message: TextKey("The installer is corrupted, please download it again"), kind: ErrExtract},
+	CodeSignature:      {message: TextKey("The installer has been modified and its signature is invalid, please download it from the official website"), kind: ErrExtract},
+	CodeExtractLimit:   {message: TextKey("{file} is too large to extract safely: {reason}"), kind: ErrExtract},
+	CodeShortcut:       {message: TextKey("Could not create the desktop shortcut: {reason}"), hint: hintRunAsAdmin, kind: ErrCopy},
+	CodeLaunch:         {message: TextKey("Could not start {file}: {reason}")},
+	CodeClientRunning:  {message: TextKey("Please exit {process} before uninstalling"), kind: ErrBlocked},
+	CodeRepairBlocked:  {message: TextKey("Please exit {process} before repairing"), kind: ErrBlocked},
+	CodeNotInstalled:   {message: TextKey("LuckyGameTools is not installed")},
+	CodeRemoveFile:     {message: TextKey("Could not remove {file}: {reason}"), hint: hintRunAsAdmin},
+	CodeUninstall:      {message: TextKey("Some files could not be removed"), hint: hintRunAsAdmin},
+}
+
+// InstallError 安装错误, 包含错误代码、出错的路径、原始错误和处理建议
+type InstallError struct {
+	Code  ErrorCode
+	Path  string
+	Cause error
+}
+
+func newInstallError(code ErrorCode, path string, cause error) *InstallError {
+	return &InstallError{Code: code, Path: path, Cause: cause}
+}
+
+// extractError 解压失败的错误, 超出解压限制时使用 CodeExtractLimit
+func extractError(code ErrorCode, path string, cause error) *InstallError {
+	if errors.Is(cause, ErrLimit) {
+		code = CodeExtractLimit
+	}
+	return newInstallError(code, path, cause)
+}
+
+func (e *InstallError) params() map[string]string {
+	params := map[string]string{
+		"file":    e.Path,
+		"dir":     e.Path,
+		"process": e.Path,
+		"code":    string(e.Code),
+	}
+	if e.Cause != nil {
+		params["reason"] = e.Cause.Error()
+	}
+	return params
+}
+
+// Message 返回当前语言的错误信息
+func (e *InstallError) Message() string {
+	return TextParams(errorDefs[e.Code].message, e.params())
+}
+
+// Hint 返回当前语言的处理建议, 可能为空
+func (e *InstallError) Hint() string {
+	hint := errorDefs[e.Code].hint
+	if hint == "" {
+		return ""
+	}
+	return Text(hint)
+}
+
+// UserMessage 返回显示给用户的完整信息: 错误信息、处理建议和错误代码
+func (e *InstallError) UserMessage() string {
+	message := e.Message()
+	if hint := e.Hint(); hint != "" {
+		message += "\r\n" + hint
+	}
+	return message + "\r\n" + TextParams("Error code: {code}", e.params())
+}
+
+func (e *InstallError) Error() string {
+	return "[" + string(e.Code) + "] " + e.Message()
+}
+
+func (e *InstallError) Unwrap() []error {
+	var errs []error
+	for _, err := range []error{errorDefs[e.Code].kind, e.Cause} {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+)
+
+// extractJob 解压压缩包中的一个文件, size 是解压后的大小
+type extractJob struct {
+	size    int64
+	extract func(ctx context.Context) error
+}
+
+// runExtractJobs 用 limits.Workers 个协程并行执行 groups, 同一组中的任务由一个协程按顺序执行.
+// 正在解压的文件大小之和不超过 limits.MemoryBudget, 比预算大的文件独占整个预算.
+// 第一个错误会取消 ctx, 其余任务尽快停止, 返回的是第一个错误.
+func runExtractJobs(ctx context.Context, limits ExtractLimits, groups [][]extractJob) error {
+	workers := limits.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	var budget *semaphore.Weighted
+	if limits.MemoryBudget > 0 {
+		budget = semaphore.NewWeighted(limits.MemoryBudget)
+	}
+
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(workers)
+	for _, group := range groups {
+		g.Go(func() error {
+			for _, job := range group {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+				weight := min(job.size, limits.MemoryBudget)
+				if budget != nil && weight > 0 {
+					if err := budget.Acquire(ctx, weight); err != nil {
+						return err
+					}
+				}
+				err := job.extract(ctx)
+				if budget != nil && weight > 0 {
+					budget.Release(weight)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// ctxReader ctx 被取消后停止读取, 让正在解压的大文件也能及时停下
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(p)
+}
+
+// progressWriter 每次写入后把写入的字节数报告给 progress
+type progressWriter struct {
+	w        io.Writer
+	name     string
+	progress func(name string, n int64)
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.progress(p.name, int64(n))
+	return n, err
+}
+
+// xorWriter 把数据和 key 循环异或后写到 w, 分多次写入的结果和 Xor 一次处理整个文件相同
+type xorWriter struct {
+	w   io.Writer
+	key []byte
+	off int
+}
+
+func (x *xorWriter) Write(b []byte) (int, error) {
+	buf := make([]byte, len(b))
+	for i, c := range b {
+		buf[i] = c ^ x.key[(x.off+i)%len(x.key)]
+	}
+	n, err := x.w.Write(buf)
+	x.off += n
+	return n, err
+}
+
+// syncProgress 让并行解压的协程串行调用 progress
+func syncProgress(progress func(name string, n int64)) func(name string, n int64) {
+	if progress == nil {
+		return nil
+	}
+	var mu sync.Mutex
+	return func(name string, n int64) {
+		mu.Lock()
+		defer mu.Unlock()
+		progress(name, n)
+	}
+}
@@ -1,15 +1,26 @@
 package main
 
 import (
-	"bufio"
 	"embed"
 	_ "embed"
-	"log"
+	"log/slog"
+	"luckygametools/internal/catalog"
+	"luckygametools/internal/locale"
+	"maps"
 	"sort"
 	"strings"
+	"sync"
+
+	"golang.org/x/text/language"
 )
 
-var localeMap = make(map[string]string)
+// localeMap 当前语言的翻译, 切换语言时由 InitI18n 整个替换, 安装协程和界面线程都会读取
+var (
+	localeMu  sync.RWMutex
+	localeMap = make(map[string]string)
+	// localeTag 当前语言的 BCP 47 标签, 决定 Textf 的复数规则
+	localeTag = language.English
+)
 
 //go:embed i18n/english.txt
 var english []byte
@@ -49,62 +60,43 @@ var local_SMap = map[string]string{
 	"Українська (Ukrainian)":                            "ukrainian",
 }
 
+// InitI18n 加载语言 i18n 的翻译并替换之前加载的语言, 返回语言代码, 例如 german.
+// i18n 可以是语言代码或 BCP 47 标签(de-AT). 界面上已经显示的文字不会自动更新
 func InitI18n(i18n string) string {
 	var i18nCode = strings.ToLower(i18n)
-	if strings.Contains(i18nCode, "chinese") {
-		if strings.Contains(i18nCode, "simplified") || i18nCode == "schinese" {
-			i18nCode = "schinese"
-		} else {
-			i18nCode = "tchinese"
-		}
-	} else if strings.Contains(i18nCode, "spanish") {
-		if strings.Contains(i18nCode, "latin") {
-			i18nCode = "latam"
-		} else {
-			i18nCode = "spanish"
-		}
-	} else if strings.Contains(i18nCode, "portuguese") {
-		if strings.Contains(i18nCode, "Brazil") {
-			i18nCode = "brazilian"
-		} else {
-			i18nCode = "portuguese"
-		}
-	} else if strings.Contains(i18nCode, "korean") {
-		i18nCode = "koreana"
+	if !IsLocaleCode(i18nCode) {
+		i18nCode = locale.Match(i18n)
 	}
 
-	i18nData, err := i18nDir.ReadFile("i18n/" + i18nCode + ".txt")
+	name := "i18n/" + i18nCode + ".txt"
+	i18nData, err := i18nDir.ReadFile(name)
 	if err != nil {
+		name = "i18n/english.txt"
 		i18nData = english
 	}
 
-	reader := strings.NewReader(string(i18nData))
-
-	// 创建一个 Scanner 来读取文件
-	scanner := bufio.NewScanner(reader)
-
-	// 按行读取文件内容
-	for scanner.Scan() {
-		line := scanner.Text()
-		split := strings.Split(line, "=")
-		if len(split) == 1 {
-			localeMap[strings.TrimSpace(split[0])] = strings.TrimSpace(split[0])
-		} else {
-			localeMap[strings.TrimSpace(split[0])] = strings.TrimSpace(split[1])
-		}
+	// 有错误的行被跳过, 其余的翻译照常使用
+	translations, err := catalog.Parse(name, i18nData)
+	if err != nil {
+		slog.Warn("parse translation", "lang", i18nCode, "err", err)
 	}
-
-	// 检查扫描错误
-	if err := scanner.Err(); err != nil {
-		log.Println("[ERROR] read i18n: ", i18n)
-		return i18nCode
+	// 占位符和英文原文不一致的翻译也被去掉, 显示英文
+	if err := translations.CheckPlaceholders(); err != nil {
+		slog.Warn("check translation placeholders", "lang", i18nCode, "err", err)
 	}
 
-	log.Println("[Info] read i18n: ", i18n, " Success")
+	localeMu.Lock()
+	localeMap = translations.Map()
+	localeTag = locale.Tag(i18nCode)
+	localeMu.Unlock()
+
+	slog.Info("read translation", "lang", i18nCode, "entries", len(translations.Entries))
 	return i18nCode
 }
 
 func Text(text string) string {
+	localeMu.RLock()
+	defer localeMu.RUnlock()
 	targetText, ok := localeMap[text]
 	if ok {
 		return targetText
@@ -116,8 +108,50 @@ func Text(text string) string {
 	return text
 }
 
+// TextKey 原样返回 text. 用来标记在别处才交给 Text 翻译的字符串, 例如错误模板, 让 cmd/i18n 能提取到它们
+func TextKey(text string) string {
+	return text
+}
+
+// Textf 翻译带命名占位符的文本, 翻译后再替换占位符, args 是交替的名字和值, 例如
+// Textf("Could not copy {file}: {reason}", "file", path, "reason", err)
+// 各语言可以按自己的语序排列占位符. 整数参数可以按当前语言的 CLDR 复数规则选择文字, 例如
+// Textf("{n, plural, one {# file} other {# files}}", "n", len(files)), 语法见 internal/catalog
+func Textf(text string, args ...any) string {
+	params := make(map[string]any, len(args)/2)
+	for i := 0; i+1 < len(args); i += 2 {
+		name, ok := args[i].(string)
+		if !ok {
+			continue
+		}
+		params[name] = args[i+1]
+	}
+	return formatText(text, params)
+}
+
+// TextParams 和 Textf 相同, 参数已经在 map 中, 例如
+// TextParams("Could not copy {file}: {reason}", map[string]string{"file": path, "reason": err.Error()})
+func TextParams(text string, params map[string]string) string {
+	args := make(map[string]any, len(params))
+	for name, value := range params {
+		args[name] = value
+	}
+	return formatText(text, args)
+}
+
+func formatText(text string, args map[string]any) string {
+	translated := Text(text)
+	localeMu.RLock()
+	tag := localeTag
+	localeMu.RUnlock()
+	return catalog.Format(translated, tag, args)
+}
+
+// GetLocaleMap 返回当前语言翻译的副本, 切换语言不会影响已经返回的结果
 func GetLocaleMap() map[string]string {
-	return localeMap
+	localeMu.RLock()
+	defer localeMu.RUnlock()
+	return maps.Clone(localeMap)
 }
 
 func GetLocaleLangs() []string {
@@ -160,3 +194,13 @@ func GetLocaleCodeIndex(code string) int {
 
 	return 0
 }
+
+// IsLocaleCode 判断是否是支持的语言代码, 例如 german
+func IsLocaleCode(code string) bool {
+	for _, val := range local_SMap {
+		if val == code {
+			return true
+		}
+	}
+	return false
+}
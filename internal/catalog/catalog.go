@@ -0,0 +1,225 @@
+// Package catalog 读取 i18n/*.txt 翻译文件. 文件是 UTF-8 文本(可以带 BOM), 每行一条翻译:
+//
+//	# 以 # 开头的行是注释, 空行被忽略
+//	Installer Path = Installationsverzeichnis
+//	Disk Space = 1 GB \= 1024 MB
+//	Installation failed = Die Installation ist fehlgeschlagen.\
+//	    Bitte versuchen Sie es erneut.
+//
+// 键和值在第一个没有转义的 = 处分开, 两边的空白被去掉. 没有 = 的行把整行作为键, 值和键相同.
+// 支持的转义: \\ \= \# \n (换行) \t (制表符) 和 "\ " (空格, 用于保留首尾的空格), 其他的 \ 开头的序列是错误.
+// 行尾的 \ (后面不能有空白) 表示值在下一行继续, 两行之间插入换行, 下一行开头的空白被去掉.
+//
+// 同一个键出现多次时以最后一次为准, 并作为错误报告.
+package catalog
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Entry 一条翻译, Line 是它在文件中开始的行号, 从 1 开始
+type Entry struct {
+	Key   string
+	Value string
+	Line  int
+}
+
+// Catalog 一个翻译文件的内容
+type Catalog struct {
+	// Name 文件名, 用于错误信息
+	Name string
+	// Entries 按键第一次出现的顺序排列, 重复的键只保留最后一次的值
+	Entries []Entry
+	// Duplicates 被后面的定义覆盖的条目
+	Duplicates []Entry
+
+	index map[string]int
+}
+
+// ParseError 翻译文件中的一个错误
+type ParseError struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.File, e.Line, e.Msg)
+}
+
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// Parse 解析名为 name 的翻译文件. 出错的行被跳过, 其余的翻译照常返回,
+// 所以返回的 Catalog 总是可用的; 错误是所有 *ParseError 的 errors.Join
+func Parse(name string, data []byte) (*Catalog, error) {
+	c := &Catalog{Name: name, index: make(map[string]int)}
+	var errs []error
+	fail := func(line int, format string, args ...any) {
+		errs = append(errs, &ParseError{File: name, Line: line, Msg: fmt.Sprintf(format, args...)})
+	}
+
+	data = bytes.TrimPrefix(data, utf8BOM)
+	lines := strings.Split(string(data), "\n")
+	for i := 0; i < len(lines); i++ {
+		lineNo := i + 1
+		line := strings.TrimSuffix(lines[i], "\r")
+		if !utf8.ValidString(line) {
+			fail(lineNo, "invalid UTF-8")
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// 把续行拼起来, 续行之间用换行分开
+		logical := strings.TrimLeft(line, " \t")
+		for continued(logical) {
+			if i+1 >= len(lines) {
+				fail(lineNo, "line continuation at end of file")
+				logical = logical[:len(logical)-1]
+				break
+			}
+			i++
+			logical = logical[:len(logical)-1] + "\n" + strings.TrimLeft(strings.TrimSuffix(lines[i], "\r"), " \t")
+		}
+
+		key, value, hasValue, err := splitEntry(logical)
+		if err != nil {
+			fail(lineNo, "%v", err)
+			continue
+		}
+		if key == "" {
+			fail(lineNo, "missing key")
+			continue
+		}
+		if !hasValue {
+			value = key
+		}
+		c.add(Entry{Key: key, Value: value, Line: lineNo}, fail)
+	}
+	return c, errors.Join(errs...)
+}
+
+func (c *Catalog) add(entry Entry, fail func(line int, format string, args ...any)) {
+	if i, ok := c.index[entry.Key]; ok {
+		previous := c.Entries[i]
+		fail(entry.Line, "duplicate key %q, first defined on line %d", entry.Key, previous.Line)
+		c.Duplicates = append(c.Duplicates, previous)
+		c.Entries[i].Value = entry.Value
+		c.Entries[i].Line = entry.Line
+		return
+	}
+	c.index[entry.Key] = len(c.Entries)
+	c.Entries = append(c.Entries, entry)
+}
+
+// continued 行尾有奇数个 \ 时, 最后一个 \ 表示续行
+func continued(line string) bool {
+	n := 0
+	for i := len(line) - 1; i >= 0 && line[i] == '\\'; i-- {
+		n++
+	}
+	return n%2 == 1
+}
+
+// splitEntry 在第一个没有转义的 = 处分开键和值, 处理转义并去掉两边没有转义的空白
+func splitEntry(line string) (key string, value string, hasValue bool, err error) {
+	var b strings.Builder
+	// end 是 b 中最后一个不是空白(或者是转义得到的)字符之后的位置
+	end := 0
+	for i := 0; i < len(line); i++ {
+		ch := line[i]
+		switch {
+		case ch == '\\':
+			if i+1 >= len(line) {
+				return "", "", false, errors.New("incomplete escape sequence")
+			}
+			i++
+			switch line[i] {
+			case '\\', '=', '#', ' ':
+				b.WriteByte(line[i])
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				r, _ := utf8.DecodeRuneInString(line[i:])
+				return "", "", false, fmt.Errorf("unknown escape sequence \\%c", r)
+			}
+			end = b.Len()
+		case ch == '=' && !hasValue:
+			key = b.String()[:end]
+			b.Reset()
+			end = 0
+			hasValue = true
+			// 跳过 = 后面的空白
+			for i+1 < len(line) && (line[i+1] == ' ' || line[i+1] == '\t') {
+				i++
+			}
+		case ch == ' ' || ch == '\t':
+			b.WriteByte(ch)
+		default:
+			b.WriteByte(ch)
+			end = b.Len()
+		}
+	}
+	if hasValue {
+		value = b.String()[:end]
+	} else {
+		key = b.String()[:end]
+	}
+	return key, value, hasValue, nil
+}
+
+// Map 返回键到值的映射
+func (c *Catalog) Map() map[string]string {
+	m := make(map[string]string, len(c.Entries))
+	for _, entry := range c.Entries {
+		m[entry.Key] = entry.Value
+	}
+	return m
+}
+
+// Lookup 返回键 key 的翻译
+func (c *Catalog) Lookup(key string) (string, bool) {
+	i, ok := c.index[key]
+	if !ok {
+		return "", false
+	}
+	return c.Entries[i].Value, true
+}
+
+// Escape 转义 s, 让它可以作为键或值写进翻译文件, 读回来和 s 相同
+func Escape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch ch := s[i]; ch {
+		case '\\', '=':
+			b.WriteByte('\\')
+			b.WriteByte(ch)
+		case '#':
+			// 只有行首的 # 会被当作注释
+			if i == 0 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(ch)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		case ' ':
+			if i == 0 || i == len(s)-1 {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+	return b.String()
+}
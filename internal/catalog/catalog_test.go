@@ -0,0 +1,126 @@
+package catalog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	data := "\uFEFF# comment\n" +
+		"   # indented comment\n" +
+		"\n" +
+		"Install = Installieren\n" +
+		"Error=Fehler  \r\n" +
+		"Directory\n" +
+		`Disk Space = 1 GB \= 1024 MB` + "\n" +
+		`Lines = one\ntwo\tthree` + "\n" +
+		`Backslash = C:\\Tools` + "\n" +
+		`\# Not a comment = \# value # not a comment` + "\n" +
+		`Spaces = \ padded\ ` + "\n" +
+		"Installation failed = Die Installation ist fehlgeschlagen.\\\n" +
+		"    Bitte versuchen Sie es erneut.\n" +
+		`Even = ends with \\` + "\n" +
+		"Last = no newline"
+	c, err := Parse("german.txt", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		key, value string
+		line       int
+	}{
+		{"Install", "Installieren", 4},
+		{"Error", "Fehler", 5},
+		{"Directory", "Directory", 6},
+		{"Disk Space", "1 GB = 1024 MB", 7},
+		{"Lines", "one\ntwo\tthree", 8},
+		{"Backslash", `C:\Tools`, 9},
+		{"# Not a comment", "# value # not a comment", 10},
+		{"Spaces", " padded ", 11},
+		{"Installation failed", "Die Installation ist fehlgeschlagen.\nBitte versuchen Sie es erneut.", 12},
+		{"Even", `ends with \`, 14},
+		{"Last", "no newline", 15},
+	}
+	if len(c.Entries) != len(tests) {
+		t.Errorf("got %d entries, want %d: %+v", len(c.Entries), len(tests), c.Entries)
+	}
+	for i, test := range tests {
+		value, ok := c.Lookup(test.key)
+		if !ok || value != test.value {
+			t.Errorf("Lookup(%q) = %q, %v, want %q", test.key, value, ok, test.value)
+		}
+		if i < len(c.Entries) && (c.Entries[i].Key != test.key || c.Entries[i].Line != test.line) {
+			t.Errorf("Entries[%d] = %q on line %d, want %q on line %d", i, c.Entries[i].Key, c.Entries[i].Line, test.key, test.line)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{"unknown escape", "a = b\nc = \\q\n", []string{"x.txt:2: unknown escape sequence \\q"}},
+		{"missing key", "= value\n", []string{"x.txt:1: missing key"}},
+		{"invalid utf-8", "a = \xff\n", []string{"x.txt:1: invalid UTF-8"}},
+		{"duplicate", "a = 1\nb = 2\na = 3\n", []string{`x.txt:3: duplicate key "a", first defined on line 1`}},
+		// 最后一行是续行, 后面没有可以接上的行
+		{"continuation at end of file", "a = 1\nb = 2\\", []string{"x.txt:2: line continuation at end of file"}},
+		{"several", "\\x\n= y\n", []string{"x.txt:1: unknown escape sequence \\x", "x.txt:2: missing key"}},
+	}
+	for _, test := range tests {
+		_, err := Parse("x.txt", []byte(test.data))
+		if err == nil {
+			t.Errorf("%s: no error", test.name)
+			continue
+		}
+		if got := strings.Split(err.Error(), "\n"); strings.Join(got, "|") != strings.Join(test.want, "|") {
+			t.Errorf("%s: error = %q, want %q", test.name, got, test.want)
+		}
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || parseErr.File != "x.txt" {
+			t.Errorf("%s: error %v is not a *ParseError", test.name, err)
+		}
+	}
+}
+
+func TestParseKeepsGoodLines(t *testing.T) {
+	c, err := Parse("x.txt", []byte("a = 1\nb = \\q\nc = 3\na = 4\n"))
+	if err == nil {
+		t.Fatal("no error")
+	}
+	if got := c.Map(); len(got) != 2 || got["a"] != "4" || got["c"] != "3" {
+		t.Errorf("Map() = %v, want a=4 c=3", got)
+	}
+	if len(c.Duplicates) != 1 || c.Duplicates[0].Value != "1" || c.Duplicates[0].Line != 1 {
+		t.Errorf("Duplicates = %+v, want a = 1 on line 1", c.Duplicates)
+	}
+	if value, _ := c.Lookup("b"); value != "" {
+		t.Errorf("Lookup(b) = %q, want nothing", value)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	for _, s := range []string{
+		"plain",
+		"a = b",
+		"# hash",
+		"in # middle",
+		`back\slash`,
+		"two\nlines",
+		"tab\there",
+		" leading and trailing ",
+		`ends with \`,
+	} {
+		c, err := Parse("x.txt", []byte(Escape(s)+" = "+Escape(s)+"\n"))
+		if err != nil {
+			t.Errorf("Escape(%q) = %q: %v", s, Escape(s), err)
+			continue
+		}
+		if value, ok := c.Lookup(s); !ok || value != s {
+			t.Errorf("Escape(%q) = %q, read back %q", s, Escape(s), value)
+		}
+	}
+}
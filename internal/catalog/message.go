@@ -0,0 +1,356 @@
+package catalog
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// 翻译文本中的占位符:
+//
+//	{name}                                         替换为参数 name 的值
+//	{n, plural, one {# file} other {# files}}      按参数 n 的 CLDR 复数类别选择一个分支, # 替换为 n
+//	{n, plural, =0 {no files} other {# files}}     =数字 精确匹配, 优先于复数类别
+//
+// 复数类别是 zero、one、two、few、many 和 other, 每种语言用到哪些类别见
+// https://www.unicode.org/cldr/charts/latest/supplemental/language_plural_rules.html, other 必须提供.
+
+// node 解析后的文本片段: 普通文本、占位符、复数选择或 #
+type node struct {
+	text     string
+	arg      string
+	plural   map[string][]node
+	isNumber bool
+}
+
+var pluralCategories = map[string]plural.Form{
+	"zero":  plural.Zero,
+	"one":   plural.One,
+	"two":   plural.Two,
+	"few":   plural.Few,
+	"many":  plural.Many,
+	"other": plural.Other,
+}
+
+// messageParser 解析一段翻译文本
+type messageParser struct {
+	s   string
+	pos int
+}
+
+func parseMessage(s string) ([]node, error) {
+	p := &messageParser{s: s}
+	nodes, err := p.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected } at offset %d", p.pos)
+	}
+	return nodes, nil
+}
+
+// parse 解析到 } 或文本结尾, 不消耗 }. inPlural 表示正在解析复数分支, 其中的 # 代表数字
+func (p *messageParser) parse(inPlural bool) ([]node, error) {
+	var nodes []node
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, node{text: text.String()})
+			text.Reset()
+		}
+	}
+	for p.pos < len(p.s) {
+		ch := p.s[p.pos]
+		switch {
+		case ch == '}':
+			flush()
+			return nodes, nil
+		case ch == '{':
+			flush()
+			n, err := p.parseArgument()
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, n)
+		case ch == '#' && inPlural:
+			flush()
+			nodes = append(nodes, node{isNumber: true})
+			p.pos++
+		default:
+			text.WriteByte(ch)
+			p.pos++
+		}
+	}
+	flush()
+	return nodes, nil
+}
+
+// parseArgument 解析 { 开始的占位符, 包括结尾的 }
+func (p *messageParser) parseArgument() (node, error) {
+	start := p.pos
+	p.pos++ // {
+	name := p.word()
+	if name == "" {
+		return node{}, fmt.Errorf("missing placeholder name at offset %d", start)
+	}
+	p.spaces()
+	if p.consume('}') {
+		return node{arg: name}, nil
+	}
+	if !p.consume(',') {
+		return node{}, fmt.Errorf("unterminated placeholder {%s", name)
+	}
+	p.spaces()
+	if kind := p.word(); kind != "plural" {
+		return node{}, fmt.Errorf("unknown placeholder type %q in {%s}", kind, name)
+	}
+	p.spaces()
+	if !p.consume(',') {
+		return node{}, fmt.Errorf("expected , after plural in {%s}", name)
+	}
+
+	branches := make(map[string][]node)
+	for {
+		p.spaces()
+		if p.consume('}') {
+			break
+		}
+		selector := p.selector()
+		if selector == "" {
+			return node{}, fmt.Errorf("expected a plural category in {%s}", name)
+		}
+		if _, ok := pluralCategories[selector]; !ok && !strings.HasPrefix(selector, "=") {
+			return node{}, fmt.Errorf("unknown plural category %q in {%s}", selector, name)
+		}
+		if _, ok := branches[selector]; ok {
+			return node{}, fmt.Errorf("duplicate plural category %q in {%s}", selector, name)
+		}
+		p.spaces()
+		if !p.consume('{') {
+			return node{}, fmt.Errorf("expected { after %s in {%s}", selector, name)
+		}
+		branch, err := p.parse(true)
+		if err != nil {
+			return node{}, err
+		}
+		if !p.consume('}') {
+			return node{}, fmt.Errorf("unterminated plural branch %s in {%s}", selector, name)
+		}
+		branches[selector] = branch
+	}
+	if _, ok := branches["other"]; !ok {
+		return node{}, fmt.Errorf("plural {%s} has no other branch", name)
+	}
+	return node{arg: name, plural: branches}, nil
+}
+
+// word 读取由字母、数字和 _ 组成的名字
+func (p *messageParser) word() string {
+	start := p.pos
+	for p.pos < len(p.s) {
+		ch := p.s[p.pos]
+		if ch != '_' && !('a' <= ch && ch <= 'z') && !('A' <= ch && ch <= 'Z') && !('0' <= ch && ch <= '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// selector 读取复数类别或 =数字
+func (p *messageParser) selector() string {
+	if p.consume('=') {
+		start := p.pos
+		for p.pos < len(p.s) && '0' <= p.s[p.pos] && p.s[p.pos] <= '9' {
+			p.pos++
+		}
+		if p.pos == start {
+			return ""
+		}
+		return "=" + p.s[start:p.pos]
+	}
+	return p.word()
+}
+
+func (p *messageParser) spaces() {
+	for p.pos < len(p.s) && (p.s[p.pos] == ' ' || p.s[p.pos] == '\t' || p.s[p.pos] == '\n') {
+		p.pos++
+	}
+}
+
+func (p *messageParser) consume(ch byte) bool {
+	if p.pos < len(p.s) && p.s[p.pos] == ch {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+// Format 替换翻译文本 message 中的占位符, tag 决定复数规则. 没有对应参数的占位符原样保留.
+// message 有语法错误时只替换简单的 {name}
+func Format(message string, tag language.Tag, args map[string]any) string {
+	nodes, err := parseMessage(message)
+	if err != nil {
+		oldnew := make([]string, 0, len(args)*2)
+		for name, value := range args {
+			oldnew = append(oldnew, "{"+name+"}", fmt.Sprint(value))
+		}
+		return strings.NewReplacer(oldnew...).Replace(message)
+	}
+	var b strings.Builder
+	format(&b, nodes, tag, args, nil)
+	return b.String()
+}
+
+func format(b *strings.Builder, nodes []node, tag language.Tag, args map[string]any, number any) {
+	for _, n := range nodes {
+		switch {
+		case n.isNumber:
+			b.WriteString(fmt.Sprint(number))
+		case n.plural != nil:
+			value, ok := args[n.arg]
+			count, isInt := toInt(value)
+			if !ok || !isInt {
+				b.WriteString("{" + n.arg + "}")
+				continue
+			}
+			format(b, selectBranch(n.plural, tag, count), tag, args, value)
+		case n.arg != "":
+			if value, ok := args[n.arg]; ok {
+				b.WriteString(fmt.Sprint(value))
+			} else {
+				b.WriteString("{" + n.arg + "}")
+			}
+		default:
+			b.WriteString(n.text)
+		}
+	}
+}
+
+// selectBranch 先找 =数字, 再按语言的复数规则找类别, 都没有时用 other
+func selectBranch(branches map[string][]node, tag language.Tag, count int64) []node {
+	if branch, ok := branches["="+strconv.FormatInt(count, 10)]; ok {
+		return branch
+	}
+	abs := count
+	if abs < 0 {
+		abs = -abs
+	}
+	form := plural.Cardinal.MatchPlural(tag, int(abs), 0, 0, 0, 0)
+	for category, f := range pluralCategories {
+		if f == form {
+			if branch, ok := branches[category]; ok {
+				return branch
+			}
+		}
+	}
+	return branches["other"]
+}
+
+func toInt(value any) (int64, bool) {
+	switch v := value.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	}
+	return 0, false
+}
+
+// Placeholders 返回 message 中用到的占位符名字, 按字母顺序排列
+func Placeholders(message string) ([]string, error) {
+	nodes, err := parseMessage(message)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	var walk func(nodes []node)
+	walk = func(nodes []node) {
+		for _, n := range nodes {
+			if n.arg != "" {
+				seen[n.arg] = true
+			}
+			for _, branch := range n.plural {
+				walk(branch)
+			}
+		}
+	}
+	walk(nodes)
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names, nil
+}
+
+// CheckPlaceholders 检查每条翻译和它的键(英文原文)用到的占位符是否相同, 以及占位符的语法.
+// 返回所有 *ParseError 的 errors.Join, 出错的条目从 Catalog 中去掉, 让 Text 显示英文原文
+func (c *Catalog) CheckPlaceholders() error {
+	var errs []error
+	kept := c.Entries[:0]
+	for _, entry := range c.Entries {
+		if err := checkEntry(entry); err != nil {
+			errs = append(errs, &ParseError{File: c.Name, Line: entry.Line, Msg: err.Error()})
+			delete(c.index, entry.Key)
+			continue
+		}
+		c.index[entry.Key] = len(kept)
+		kept = append(kept, entry)
+	}
+	c.Entries = kept
+	return errors.Join(errs...)
+}
+
+func checkEntry(entry Entry) error {
+	want, err := Placeholders(entry.Key)
+	if err != nil {
+		return fmt.Errorf("key %q: %v", entry.Key, err)
+	}
+	got, err := Placeholders(entry.Value)
+	if err != nil {
+		return fmt.Errorf("translation of %q: %v", entry.Key, err)
+	}
+	var missing, unknown []string
+	for _, name := range want {
+		if !slices.Contains(got, name) {
+			missing = append(missing, "{"+name+"}")
+		}
+	}
+	for _, name := range got {
+		if !slices.Contains(want, name) {
+			unknown = append(unknown, "{"+name+"}")
+		}
+	}
+	switch {
+	case len(missing) > 0 && len(unknown) > 0:
+		return fmt.Errorf("translation of %q is missing %s and has unknown %s", entry.Key, strings.Join(missing, " "), strings.Join(unknown, " "))
+	case len(missing) > 0:
+		return fmt.Errorf("translation of %q is missing %s", entry.Key, strings.Join(missing, " "))
+	case len(unknown) > 0:
+		return fmt.Errorf("translation of %q has unknown %s", entry.Key, strings.Join(unknown, " "))
+	}
+	return nil
+}
@@ -0,0 +1,132 @@
+package catalog
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/text/language"
+)
+
+func TestFormatPlural(t *testing.T) {
+	const files = "{n, plural, =0 {no files} zero {# zero} one {# one} two {# two} few {# few} many {# many} other {# other}}"
+	tests := []struct {
+		lang   string
+		counts map[int]string
+	}{
+		{"en", map[int]string{0: "no files", 1: "1 one", 2: "2 other", 5: "5 other", 21: "21 other"}},
+		{"ru", map[int]string{1: "1 one", 2: "2 few", 4: "4 few", 5: "5 many", 11: "11 many", 21: "21 one", 22: "22 few", 25: "25 many", 111: "111 many"}},
+		{"pl", map[int]string{1: "1 one", 2: "2 few", 5: "5 many", 12: "12 many", 22: "22 few", 101: "101 many"}},
+		{"ar", map[int]string{0: "no files", 1: "1 one", 2: "2 two", 3: "3 few", 10: "10 few", 11: "11 many", 99: "99 many", 100: "100 other", 102: "102 other"}},
+		{"ja", map[int]string{0: "no files", 1: "1 other", 2: "2 other", 100: "100 other"}},
+	}
+	for _, test := range tests {
+		tag := language.MustParse(test.lang)
+		for n, want := range test.counts {
+			if got := Format(files, tag, map[string]any{"n": n}); got != want {
+				t.Errorf("%s: Format(n=%d) = %q, want %q", test.lang, n, got, want)
+			}
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	en := language.English
+	tests := []struct {
+		name    string
+		message string
+		args    map[string]any
+		want    string
+	}{
+		{"placeholder", "Could not copy {file}: {reason}", map[string]any{"file": `C:\x`, "reason": "denied"}, `Could not copy C:\x: denied`},
+		{"repeated", "{a} and {a}", map[string]any{"a": 1}, "1 and 1"},
+		{"missing argument", "Could not copy {file}", nil, "Could not copy {file}"},
+		{"missing plural argument", "{n, plural, one {# file} other {# files}}", nil, "{n}"},
+		{"plural argument is not a number", "{n, plural, one {# file} other {# files}}", map[string]any{"n": "x"}, "{n}"},
+		{"# outside plural", "#1 {n, plural, one {# file} other {# files}}", map[string]any{"n": 3}, "#1 3 files"},
+		{"exact match before category", "{n, plural, =1 {a single file} one {# file} other {# files}}", map[string]any{"n": 1}, "a single file"},
+		{"unsigned", "{n, plural, one {# file} other {# files}}", map[string]any{"n": uint64(1)}, "1 file"},
+		{"placeholder in branch", "{n, plural, one {# file in {dir}} other {# files in {dir}}}", map[string]any{"n": 2, "dir": "D:"}, "2 files in D:"},
+		{"nested plural", "{a, plural, one {# app, {b, plural, one {# file} other {# files}}} other {# apps}}", map[string]any{"a": 1, "b": 4}, "1 app, 4 files"},
+		{"whitespace", "{n , plural ,\n one {# file}\n other {# files} }", map[string]any{"n": 1}, "1 file"},
+		// 语法错误时只替换简单的 {name}
+		{"syntax error", "{n, plural, one {# file}} {dir}", map[string]any{"n": 1, "dir": "D:"}, "{n, plural, one {# file}} D:"},
+		{"unbalanced", "{dir}}", map[string]any{"dir": "D:"}, "D:}"},
+	}
+	for _, test := range tests {
+		if got := Format(test.message, en, test.args); got != test.want {
+			t.Errorf("%s: Format(%q) = %q, want %q", test.name, test.message, got, test.want)
+		}
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	tests := []struct {
+		message string
+		want    []string
+		err     string
+	}{
+		{"no placeholders", []string{}, ""},
+		{"{b} {a} {b}", []string{"a", "b"}, ""},
+		{"{n, plural, one {# file in {dir}} other {# files}}", []string{"dir", "n"}, ""},
+		{"{n, plural, one {# file}}", nil, "plural {n} has no other branch"},
+		{"{n, plural, few {#} other {#} few {#}}", nil, `duplicate plural category "few" in {n}`},
+		{"{n, plural, some {#} other {#}}", nil, `unknown plural category "some" in {n}`},
+		{"{n, select, a {#} other {#}}", nil, `unknown placeholder type "select" in {n}`},
+		{"{}", nil, "missing placeholder name at offset 0"},
+		{"{n", nil, "unterminated placeholder {n"},
+		{"a}", nil, "unexpected } at offset 1"},
+	}
+	for _, test := range tests {
+		got, err := Placeholders(test.message)
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("Placeholders(%q) error = %v, want %s", test.message, err, test.err)
+			}
+			continue
+		}
+		if err != nil || !slices.Equal(got, test.want) {
+			t.Errorf("Placeholders(%q) = %q, %v, want %q", test.message, got, err, test.want)
+		}
+	}
+}
+
+func TestCheckPlaceholders(t *testing.T) {
+	data := strings.Join([]string{
+		"Could not copy {file} = Konnte {file} nicht kopieren",
+		"{n, plural, one {# file restored} other {# files restored}} = {n, plural, one {# Datei} other {# Dateien}} wiederhergestellt",
+		// 翻译中缺少 {n}
+		"{n, plural, one {# file} other {# files}} in {dir} = Dateien in {dir}",
+		"Could not create {dir} = Konnte {path} nicht anlegen",
+		"Broken {dir} = Kaputt {dir",
+		"Install = Installieren",
+	}, "\n")
+	c, err := Parse("german.txt", []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.CheckPlaceholders()
+	want := []string{
+		`german.txt:3: translation of "{n, plural, one {# file} other {# files}} in {dir}" is missing {n}`,
+		`german.txt:4: translation of "Could not create {dir}" is missing {dir} and has unknown {path}`,
+		`german.txt:5: translation of "Broken {dir}": unterminated placeholder {dir`,
+	}
+	if err == nil || err.Error() != strings.Join(want, "\n") {
+		t.Errorf("CheckPlaceholders() = %v, want\n%s", err, strings.Join(want, "\n"))
+	}
+
+	// 出错的翻译被去掉, Text 会显示英文原文
+	for _, key := range []string{"{n, plural, one {# file} other {# files}} in {dir}", "Could not create {dir}", "Broken {dir}"} {
+		if value, ok := c.Lookup(key); ok {
+			t.Errorf("Lookup(%q) = %q, want it removed", key, value)
+		}
+	}
+	for _, key := range []string{"Could not copy {file}", "Install"} {
+		if _, ok := c.Lookup(key); !ok {
+			t.Errorf("Lookup(%q) missing, want it kept", key)
+		}
+	}
+	if len(c.Entries) != 3 {
+		t.Errorf("got %d entries, want 3", len(c.Entries))
+	}
+}
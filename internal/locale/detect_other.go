@@ -0,0 +1,10 @@
+//go:build !windows
+
+package locale
+
+import "os"
+
+// SystemTags 返回 LANGUAGE、LC_ALL、LC_MESSAGES 和 LANG 中的首选语言, 见 FromEnv
+func SystemTags() []string {
+	return FromEnv(os.Getenv)
+}
@@ -0,0 +1,37 @@
+package locale
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+var (
+	kernel32                 = windows.NewLazySystemDLL("kernel32.dll")
+	getUserDefaultUILanguage = kernel32.NewProc("GetUserDefaultUILanguage")
+	lcidToLocaleName         = kernel32.NewProc("LCIDToLocaleName")
+)
+
+// SystemTags 返回用户的首选界面语言, 例如 [pt-BR en-US].
+// 取不到首选语言列表时用界面语言的 LCID 换算为 BCP 47 标签
+func SystemTags() []string {
+	tags, err := windows.GetUserPreferredUILanguages(windows.MUI_LANGUAGE_NAME)
+	if err == nil && len(tags) > 0 {
+		return tags
+	}
+	lcid, _, _ := getUserDefaultUILanguage.Call()
+	if tag := lcidToTag(uint32(lcid)); tag != "" {
+		return []string{tag}
+	}
+	return nil
+}
+
+// lcidToTag 把 LCID (例如 0x0416) 转为 BCP 47 标签 (pt-BR)
+func lcidToTag(lcid uint32) string {
+	buf := make([]uint16, 85) // LOCALE_NAME_MAX_LENGTH
+	ret, _, _ := lcidToLocaleName.Call(uintptr(lcid), uintptr(unsafe.Pointer(&buf[0])), uintptr(len(buf)), 0)
+	if ret == 0 {
+		return ""
+	}
+	return windows.UTF16ToString(buf)
+}
@@ -0,0 +1,143 @@
+// Package locale 把系统语言(BCP 47 标签, 例如 pt-BR、zh-Hant-TW)对应到安装程序的翻译文件(例如 brazilian).
+//
+// 匹配规则由 golang.org/x/text/language 提供, 按以下顺序回退:
+//  1. 语言、文字和地区都相同, 例如 pt-BR → brazilian, es-ES → spanish
+//  2. 同一种语言的相近变体, 例如 es-MX → latam (拉丁美洲西班牙语), zh-SG → schinese, zh-HK → tchinese, nn → norwegian
+//  3. 同一种语言的其他变体, 例如 fr-CA → french, pt → brazilian (CLDR 中 pt 默认指巴西葡萄牙语)
+//  4. 都不匹配时使用 english
+//
+// 系统有多个首选语言时依次尝试, 只要有一个能匹配就不会回退到 english.
+package locale
+
+import (
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// Default 没有匹配的翻译时使用的语言
+const Default = "english"
+
+// codes 翻译文件名和对应的 BCP 47 标签, 一个翻译可以对应多个标签, 第一项是默认语言
+var codes = []struct {
+	code string
+	tags []string
+}{
+	{"english", []string{"en"}},
+	{"schinese", []string{"zh-Hans"}},
+	{"tchinese", []string{"zh-Hant"}},
+	{"japanese", []string{"ja"}},
+	{"koreana", []string{"ko"}},
+	{"thai", []string{"th"}},
+	{"bulgarian", []string{"bg"}},
+	{"czech", []string{"cs"}},
+	{"danish", []string{"da"}},
+	{"german", []string{"de"}},
+	{"spanish", []string{"es-ES"}},
+	{"latam", []string{"es-419"}},
+	{"greek", []string{"el"}},
+	{"french", []string{"fr"}},
+	{"italian", []string{"it"}},
+	{"indonesian", []string{"id"}},
+	{"hungarian", []string{"hu"}},
+	{"dutch", []string{"nl"}},
+	{"norwegian", []string{"nb", "nn"}},
+	{"polish", []string{"pl"}},
+	{"portuguese", []string{"pt-PT"}},
+	{"brazilian", []string{"pt-BR"}},
+	{"romanian", []string{"ro"}},
+	{"russian", []string{"ru"}},
+	{"finnish", []string{"fi"}},
+	{"swedish", []string{"sv"}},
+	{"turkish", []string{"tr"}},
+	{"vietnamese", []string{"vi"}},
+	{"ukrainian", []string{"uk"}},
+}
+
+var (
+	// supported 和 supportedCodes 一一对应
+	supported      []language.Tag
+	supportedCodes []string
+	matcher        language.Matcher
+)
+
+func init() {
+	for _, c := range codes {
+		for _, tag := range c.tags {
+			supported = append(supported, language.MustParse(tag))
+			supportedCodes = append(supportedCodes, c.code)
+		}
+	}
+	matcher = language.NewMatcher(supported)
+}
+
+// Tag 返回翻译 code 的 BCP 47 标签, 不支持的 code 返回 language.Und
+func Tag(code string) language.Tag {
+	for i, c := range supportedCodes {
+		if c == code {
+			return supported[i]
+		}
+	}
+	return language.Und
+}
+
+// Match 按优先顺序给出的 BCP 47 标签找到最合适的翻译, 无法解析的标签被忽略.
+// 也接受 POSIX 格式, 例如 pt_BR.UTF-8
+func Match(tags ...string) string {
+	var parsed []language.Tag
+	for _, tag := range tags {
+		t, err := language.Parse(posixToBCP47(tag))
+		if err != nil || t == language.Und {
+			continue
+		}
+		parsed = append(parsed, t)
+	}
+	if len(parsed) == 0 {
+		return Default
+	}
+	_, index, confidence := matcher.Match(parsed...)
+	if confidence == language.No {
+		return Default
+	}
+	return supportedCodes[index]
+}
+
+// posixToBCP47 把 pt_BR.UTF-8@euro 这样的 POSIX locale 转为 pt-BR, C 和 POSIX 返回空字符串
+func posixToBCP47(s string) string {
+	if i := strings.IndexAny(s, ".@"); i >= 0 {
+		s = s[:i]
+	}
+	if s == "C" || s == "POSIX" {
+		return ""
+	}
+	return strings.ReplaceAll(s, "_", "-")
+}
+
+// FromEnv 按 gettext 的规则从环境变量读取首选语言: LANGUAGE 中用冒号分隔的列表优先,
+// 然后是 LC_ALL、LC_MESSAGES、LANG 中第一个非空的值. LC_ALL 或 LANG 为 C 时忽略 LANGUAGE.
+func FromEnv(getenv func(string) string) []string {
+	var locale string
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale = getenv(name); locale != "" {
+			break
+		}
+	}
+	if posixToBCP47(locale) == "" && locale != "" {
+		return nil
+	}
+	var tags []string
+	for _, tag := range strings.Split(getenv("LANGUAGE"), ":") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	if locale != "" {
+		tags = append(tags, locale)
+	}
+	return tags
+}
+
+// Detect 返回系统首选语言对应的翻译
+func Detect() string {
+	return Match(SystemTags()...)
+}
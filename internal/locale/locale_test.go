@@ -0,0 +1,81 @@
+package locale
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		tags []string
+		want string
+	}{
+		{[]string{"pt"}, "brazilian"},
+		{[]string{"pt-BR"}, "brazilian"},
+		{[]string{"pt-PT"}, "portuguese"},
+		{[]string{"es-ES"}, "spanish"},
+		{[]string{"es-MX"}, "latam"},
+		{[]string{"es-419"}, "latam"},
+		{[]string{"zh-CN"}, "schinese"},
+		{[]string{"zh-SG"}, "schinese"},
+		{[]string{"zh-TW"}, "tchinese"},
+		{[]string{"zh-HK"}, "tchinese"},
+		{[]string{"zh-Hant"}, "tchinese"},
+		{[]string{"fr-CA"}, "french"},
+		{[]string{"nn-NO"}, "norwegian"},
+		{[]string{"de_DE.UTF-8"}, "german"},
+		{[]string{"pt_BR.UTF-8@euro"}, "brazilian"},
+		{[]string{"en-US"}, "english"},
+		{[]string{"tlh"}, "english"},
+		{[]string{"not a tag"}, "english"},
+		{[]string{"C"}, "english"},
+		{nil, "english"},
+		// 第一个不支持时使用下一个
+		{[]string{"tlh", "ja-JP"}, "japanese"},
+		{[]string{"", "ko-KR"}, "koreana"},
+	}
+	for _, test := range tests {
+		if got := Match(test.tags...); got != test.want {
+			t.Errorf("Match(%q) = %s, want %s", test.tags, got, test.want)
+		}
+	}
+}
+
+func TestFromEnv(t *testing.T) {
+	tests := []struct {
+		env  map[string]string
+		want []string
+	}{
+		{map[string]string{}, nil},
+		{map[string]string{"LANG": "de_DE.UTF-8"}, []string{"de_DE.UTF-8"}},
+		{map[string]string{"LANG": "de_DE.UTF-8", "LC_MESSAGES": "fr_FR.UTF-8"}, []string{"fr_FR.UTF-8"}},
+		{map[string]string{"LANG": "de_DE.UTF-8", "LC_MESSAGES": "fr_FR.UTF-8", "LC_ALL": "ja_JP.UTF-8"}, []string{"ja_JP.UTF-8"}},
+		{map[string]string{"LANG": "de_DE.UTF-8", "LANGUAGE": "pt_BR:fr"}, []string{"pt_BR", "fr", "de_DE.UTF-8"}},
+		{map[string]string{"LANGUAGE": "::ru:"}, []string{"ru"}},
+		// C 和 POSIX 表示不使用任何语言, LANGUAGE 也被忽略
+		{map[string]string{"LANG": "C", "LANGUAGE": "de"}, nil},
+		{map[string]string{"LC_ALL": "POSIX", "LANG": "de_DE.UTF-8"}, nil},
+		{map[string]string{"LC_ALL": "C.UTF-8", "LANGUAGE": "de"}, nil},
+	}
+	for _, test := range tests {
+		got := FromEnv(func(name string) string { return test.env[name] })
+		if !slices.Equal(got, test.want) {
+			t.Errorf("FromEnv(%v) = %q, want %q", test.env, got, test.want)
+		}
+	}
+
+	// 环境变量中的 .UTF-8 后缀不影响匹配
+	env := map[string]string{"LC_ALL": "es_MX.UTF-8", "LANG": "de_DE.UTF-8"}
+	if got := Match(FromEnv(func(name string) string { return env[name] })...); got != "latam" {
+		t.Errorf("Match(FromEnv(%v)) = %s, want latam", env, got)
+	}
+}
+
+func TestTag(t *testing.T) {
+	if got := Tag("brazilian").String(); got != "pt-BR" {
+		t.Errorf("Tag(brazilian) = %s, want pt-BR", got)
+	}
+	if got := Tag("klingon").String(); got != "und" {
+		t.Errorf("Tag(klingon) = %s, want und", got)
+	}
+}
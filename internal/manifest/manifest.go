@@ -0,0 +1,171 @@
+// Package manifest 描述安装程序内嵌的压缩包: 每个压缩包中有哪些文件, 它们的大小、SHA-256 和安装位置.
+// 清单由 cmd/genmanifest 在 go generate 时生成, 解压、校验、修复和卸载都以它为准.
+package manifest
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"luckygametools/internal/safepath"
+)
+
+// 压缩包格式
+const (
+	FormatZip = "zip"
+	Format7z  = "7z"
+)
+
+// 压缩包解压到的根目录
+const (
+	RootInstall = "install" // 安装目录
+	RootAppdata = "appdata" // %APPDATA%\luckygametools
+)
+
+// File 压缩包中的一个文件
+type File struct {
+	// Name 压缩包中的路径, Target 相对于根目录的安装路径, 都使用 / 分隔
+	Name   string `json:"name"`
+	Target string `json:"target"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Payload 一个内嵌的压缩包
+type Payload struct {
+	// Path 内嵌文件相对于仓库根目录的路径, 例如 exe/GamePower.zip
+	Path      string `json:"path"`
+	Format    string `json:"format"`
+	Component string `json:"component"`
+	Root      string `json:"root"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+	Files     []File `json:"files"`
+}
+
+// Blob 一个不需要解压的内嵌文件, 例如默认配置
+type Blob struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest 所有内嵌压缩包的清单, Payloads 的顺序即安装顺序
+type Manifest struct {
+	Payloads []Payload `json:"payloads"`
+	Blobs    []Blob    `json:"blobs,omitempty"`
+}
+
+// Parse 解析并校验清单
+func Parse(data []byte) (*Manifest, error) {
+	m := &Manifest{}
+	if err := json.Unmarshal(data, m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate 检查清单中的格式、根目录和文件路径, 压缩包中的路径和安装路径都不能跳出根目录
+func (m *Manifest) Validate() error {
+	var errs []error
+	for _, p := range m.Payloads {
+		if p.Format != FormatZip && p.Format != Format7z {
+			errs = append(errs, fmt.Errorf("%s: unknown format %q", p.Path, p.Format))
+		}
+		if p.Root != RootInstall && p.Root != RootAppdata {
+			errs = append(errs, fmt.Errorf("%s: unknown root %q", p.Path, p.Root))
+		}
+		for _, f := range p.Files {
+			if !IsLocalPath(f.Name) {
+				errs = append(errs, fmt.Errorf("%s: invalid name %q", p.Path, f.Name))
+			}
+			if !IsLocalPath(f.Target) {
+				errs = append(errs, fmt.Errorf("%s: invalid target %q", p.Path, f.Target))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// IsLocalPath 判断 / 分隔的相对路径是否停留在根目录之内, 规则见 internal/safepath
+func IsLocalPath(name string) bool {
+	return !strings.Contains(name, `\`) && safepath.IsLocal(name)
+}
+
+// Payload 按内嵌路径查找压缩包
+func (m *Manifest) Payload(path string) *Payload {
+	for i := range m.Payloads {
+		if m.Payloads[i].Path == path {
+			return &m.Payloads[i]
+		}
+	}
+	return nil
+}
+
+// Digests 返回所有内嵌文件(压缩包和 Blob)的路径 -> 大小和 SHA-256
+func (m *Manifest) Digests() map[string]Blob {
+	digests := make(map[string]Blob)
+	for _, p := range m.Payloads {
+		digests[p.Path] = Blob{Path: p.Path, Size: p.Size, SHA256: p.SHA256}
+	}
+	for _, b := range m.Blobs {
+		digests[b.Path] = b
+	}
+	return digests
+}
+
+// Check 检查内嵌数据是否和记录的大小、SHA-256 一致
+func (b Blob) Check(data []byte) error {
+	if int64(len(data)) != b.Size {
+		return fmt.Errorf("%s: size %d, expected %d", b.Path, len(data), b.Size)
+	}
+	if sum := SumBytes(data); sum != b.SHA256 {
+		return fmt.Errorf("%s: sha256 %s, expected %s", b.Path, sum, b.SHA256)
+	}
+	return nil
+}
+
+// RenameMap 返回解压时需要改名的文件, 压缩包中的路径 -> 安装路径
+func (p *Payload) RenameMap() map[string]string {
+	renameMap := make(map[string]string)
+	for _, f := range p.Files {
+		if f.Name != f.Target {
+			renameMap[f.Name] = f.Target
+		}
+	}
+	return renameMap
+}
+
+// Sum 读完 r, 返回长度和十六进制的 SHA-256
+func Sum(r io.Reader) (int64, string, error) {
+	hash := sha256.New()
+	n, err := io.Copy(hash, r)
+	if err != nil {
+		return n, "", err
+	}
+	return n, hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// SumFile 返回文件的长度和 SHA-256
+func SumFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	return Sum(f)
+}
+
+// SumBytes 返回 data 的 SHA-256
+func SumBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,70 @@
+package manifest
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ErrSignature 清单签名不正确, 清单或其中记录的压缩包可能被修改过
+var ErrSignature = errors.New("manifest signature does not verify")
+
+// 签名和密钥都以 base64 文本保存, 方便放进源码和 go:embed
+var encoding = base64.StdEncoding
+
+// GenerateKey 生成签名密钥, 返回 base64 编码的私钥和公钥
+func GenerateKey() (privateKey string, publicKey string, err error) {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		return "", "", err
+	}
+	return encoding.EncodeToString(private.Seed()), encoding.EncodeToString(public), nil
+}
+
+// LoadPrivateKey 读取 GenerateKey 生成的私钥文件
+func LoadPrivateKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := encoding.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("%s: invalid private key", path)
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// ParsePublicKey 解析 base64 编码的公钥
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := encoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("invalid public key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// Sign 对清单的原始字节签名, 返回 base64 编码的签名
+func Sign(data []byte, key ed25519.PrivateKey) []byte {
+	return []byte(encoding.EncodeToString(ed25519.Sign(key, data)) + "\n")
+}
+
+// Verify 检查 base64 编码的签名, 不正确时返回 ErrSignature
+func Verify(data []byte, signature []byte, key ed25519.PublicKey) error {
+	sig, err := encoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil || len(sig) != ed25519.SignatureSize || !ed25519.Verify(key, data, sig) {
+		return ErrSignature
+	}
+	return nil
+}
+
+// ParseSigned 先验证签名再解析清单. 内嵌的清单和将来在线下载的清单都通过它读取,
+// 签名不正确的清单不会被解析, 其中的哈希也就不会被信任.
+func ParseSigned(data []byte, signature []byte, key ed25519.PublicKey) (*Manifest, error) {
+	if err := Verify(data, signature, key); err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
@@ -0,0 +1,121 @@
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testManifest = `{
+  "payloads": [
+    {
+      "path": "exe/GamePower.zip",
+      "format": "zip",
+      "component": "client",
+      "root": "install",
+      "size": 3,
+      "sha256": "0000000000000000000000000000000000000000000000000000000000000000",
+      "files": [{"name": "GamePower.exe", "target": "GamePower.exe", "size": 3, "sha256": "0000000000000000000000000000000000000000000000000000000000000000"}]
+    }
+  ]
+}
+`
+
+// testKey 用 GenerateKey 生成一对密钥, 并像 genmanifest 一样从文件读回私钥
+func testKey(t *testing.T) (ed25519.PrivateKey, ed25519.PublicKey) {
+	t.Helper()
+	private, public, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "manifest.key")
+	if err := os.WriteFile(path, []byte(private+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	privateKey, err := LoadPrivateKey(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := ParsePublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, publicKey
+}
+
+func TestSignRoundTrip(t *testing.T) {
+	private, public := testKey(t)
+	data := []byte(testManifest)
+	sig := Sign(data, private)
+	if err := Verify(data, sig, public); err != nil {
+		t.Fatalf("Verify: %v", err)
+	}
+	m, err := ParseSigned(data, sig, public)
+	if err != nil {
+		t.Fatalf("ParseSigned: %v", err)
+	}
+	if p := m.Payload("exe/GamePower.zip"); p == nil || len(p.Files) != 1 {
+		t.Fatalf("ParseSigned returned %+v", m)
+	}
+}
+
+func TestVerifyRejects(t *testing.T) {
+	private, public := testKey(t)
+	_, otherPublic := testKey(t)
+	data := []byte(testManifest)
+	sig := Sign(data, private)
+
+	// 改动清单中的一个字节, 例如把文件大小 3 改成 4
+	modified := bytes.Replace(data, []byte(`"size": 3,`), []byte(`"size": 4,`), 1)
+	if bytes.Equal(modified, data) {
+		t.Fatal("test manifest not modified")
+	}
+	flipped := bytes.Clone(sig)
+	flipped[0] ^= 'A' ^ 'B'
+
+	tests := []struct {
+		name string
+		data []byte
+		sig  []byte
+		key  ed25519.PublicKey
+	}{
+		{"modified manifest", modified, sig, public},
+		{"trailing byte", append(bytes.Clone(data), ' '), sig, public},
+		{"wrong key", data, sig, otherPublic},
+		{"modified signature", data, flipped, public},
+		{"truncated signature", data, sig[:len(sig)/2], public},
+		{"missing signature", data, nil, public},
+		{"not base64", data, []byte("not a signature!"), public},
+	}
+	for _, test := range tests {
+		if err := Verify(test.data, test.sig, test.key); !errors.Is(err, ErrSignature) {
+			t.Errorf("%s: Verify = %v, want ErrSignature", test.name, err)
+		}
+		if m, err := ParseSigned(test.data, test.sig, test.key); !errors.Is(err, ErrSignature) || m != nil {
+			t.Errorf("%s: ParseSigned = %v, %v, want ErrSignature", test.name, m, err)
+		}
+	}
+}
+
+func TestParseSignedInvalidManifest(t *testing.T) {
+	private, public := testKey(t)
+	// 签名正确, 但清单中的路径跳出了安装目录
+	data := bytes.Replace([]byte(testManifest), []byte(`"target": "GamePower.exe"`), []byte(`"target": "../GamePower.exe"`), 1)
+	if _, err := ParseSigned(data, Sign(data, private), public); err == nil || errors.Is(err, ErrSignature) {
+		t.Errorf("ParseSigned = %v, want a validation error", err)
+	}
+}
+
+func TestKeyErrors(t *testing.T) {
+	if _, err := ParsePublicKey("AAAA"); err == nil {
+		t.Error("ParsePublicKey accepted a short key")
+	}
+	path := filepath.Join(t.TempDir(), "bad.key")
+	os.WriteFile(path, []byte("not base64"), 0600)
+	if _, err := LoadPrivateKey(path); err == nil {
+		t.Error("LoadPrivateKey accepted an invalid key")
+	}
+}
@@ -0,0 +1,95 @@
+// Package safepath 检查压缩包和清单中的路径, 防止解压时写到目标目录之外 (zip slip).
+//
+// 压缩包可能在任何系统上制作, 安装程序却运行在 Windows 上, 所以无论在哪个系统上运行,
+// 都按 Windows 的规则检查: \ 和 / 都是分隔符, 盘符、UNC 路径、\\?\ 前缀和 CON、NUL、COM1 这样的设备名都不允许.
+package safepath
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrUnsafe 压缩包中的路径会写到目标目录之外
+var ErrUnsafe = errors.New("unsafe path in archive")
+
+// Error 压缩包中的路径是绝对路径、带盘符或 UNC 前缀、是设备名, 或者通过 .. 跳出目标目录
+type Error struct {
+	Name string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%v: %q", ErrUnsafe, e.Name)
+}
+
+func (e *Error) Unwrap() error {
+	return ErrUnsafe
+}
+
+// reservedNames Windows 的设备名, 加上任何扩展名(例如 NUL.txt)仍然指向设备
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true, "CONIN$": true, "CONOUT$": true,
+}
+
+// IsLocal 判断相对路径 name 是否停留在根目录之内, \ 和 / 都视为分隔符
+func IsLocal(name string) bool {
+	slashed := strings.ReplaceAll(name, `\`, "/")
+	// 开头的 / 包括了绝对路径、UNC 路径 (//server/share) 和 //?/ 前缀; : 包括了盘符和 NTFS 数据流
+	if slashed == "" || strings.HasPrefix(slashed, "/") || strings.ContainsAny(slashed, `:<>"|?*`) {
+		return false
+	}
+	clean := path.Clean(slashed)
+	if clean == "." || clean == ".." || strings.HasPrefix(clean, "../") {
+		return false
+	}
+	for _, elem := range strings.Split(clean, "/") {
+		if !isLocalElem(elem) {
+			return false
+		}
+	}
+	return true
+}
+
+// isLocalElem 检查路径中的一段. Windows 会去掉结尾的 . 和空格, 所以 ".. " 等于 ..
+func isLocalElem(elem string) bool {
+	if strings.TrimRight(elem, ". ") == "" {
+		return false
+	}
+	for _, r := range elem {
+		if r < 0x20 {
+			return false
+		}
+	}
+	base, _, _ := strings.Cut(elem, ".")
+	base = strings.ToUpper(strings.TrimRight(base, " "))
+	if reservedNames[base] {
+		return false
+	}
+	if len(base) >= 4 && (strings.HasPrefix(base, "COM") || strings.HasPrefix(base, "LPT")) {
+		switch base[3:] {
+		case "0", "1", "2", "3", "4", "5", "6", "7", "8", "9", "¹", "²", "³":
+			return false
+		}
+	}
+	return true
+}
+
+// Join 把压缩包中的路径 name 拼到 destDir 下, name 不安全时返回 *Error
+func Join(destDir, name string) (string, error) {
+	if !IsLocal(name) {
+		return "", &Error{Name: name}
+	}
+	slashed := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	joined := filepath.Join(destDir, filepath.FromSlash(slashed))
+	// destDir 是根目录 (C:\ 或 /) 时本身就以分隔符结尾
+	prefix := filepath.Clean(destDir)
+	if !strings.HasSuffix(prefix, string(filepath.Separator)) {
+		prefix += string(filepath.Separator)
+	}
+	if !strings.HasPrefix(joined, prefix) {
+		return "", &Error{Name: name}
+	}
+	return joined, nil
+}
@@ -0,0 +1,115 @@
+package safepath
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unsafeNames 压缩包中常见的恶意路径, 也是 FuzzSafeJoin 的种子
+var unsafeNames = []string{
+	`..\..\Windows\x.dll`,
+	`../../Windows/x.dll`,
+	`C:\x`,
+	`C:x`,
+	`c:/x`,
+	`\\server\share\x`,
+	`//server/share/x`,
+	`\\?\C:\x`,
+	`\\.\NUL`,
+	`\x`,
+	`/etc/passwd`,
+	`NUL`,
+	`nul.txt`,
+	`COM1.txt`,
+	`a/LPT9`,
+	`a/con .log`,
+	`COM¹`,
+	`a/../../b`,
+	`a/..\..\b`,
+	`..`,
+	`.. `,
+	`a/.../b`,
+	`.`,
+	``,
+	`a/b:stream`,
+	`a/b?`,
+	"a/b\x00c",
+}
+
+var safeNames = []string{
+	`GamePower.exe`,
+	`locales/zh-CN.pak`,
+	`locales\en-US.pak`,
+	`a/./b`,
+	`a/b/../c`,
+	`.hidden`,
+	`a..b`,
+	`CONFIG.json`,
+	`COM10.txt`,
+	`console.log`,
+	`LPT.dll`,
+}
+
+func TestIsLocal(t *testing.T) {
+	for _, name := range unsafeNames {
+		if IsLocal(name) {
+			t.Errorf("IsLocal(%q) = true, want false", name)
+		}
+	}
+	for _, name := range safeNames {
+		if !IsLocal(name) {
+			t.Errorf("IsLocal(%q) = false, want true", name)
+		}
+	}
+}
+
+func TestJoin(t *testing.T) {
+	dest := t.TempDir()
+	for _, name := range unsafeNames {
+		if got, err := Join(dest, name); !errors.Is(err, ErrUnsafe) {
+			t.Errorf("Join(%q) = %q, %v, want ErrUnsafe", name, got, err)
+		}
+	}
+	tests := []struct {
+		name string
+		want string
+	}{
+		{`GamePower.exe`, "GamePower.exe"},
+		{`locales\en-US.pak`, filepath.Join("locales", "en-US.pak")},
+		{`a/b/../c`, filepath.Join("a", "c")},
+	}
+	for _, test := range tests {
+		got, err := Join(dest, test.name)
+		if err != nil || got != filepath.Join(dest, test.want) {
+			t.Errorf("Join(%q) = %q, %v, want %q", test.name, got, err, filepath.Join(dest, test.want))
+		}
+	}
+}
+
+func FuzzSafeJoin(f *testing.F) {
+	for _, name := range append(unsafeNames, safeNames...) {
+		f.Add(name)
+	}
+	dest := filepath.Join(f.TempDir(), "install")
+	f.Fuzz(func(t *testing.T, name string) {
+		got, err := Join(dest, name)
+		if err != nil {
+			var pathErr *Error
+			if !errors.As(err, &pathErr) || pathErr.Name != name {
+				t.Fatalf("Join(%q) error = %v, want *Error", name, err)
+			}
+			return
+		}
+		rel, err := filepath.Rel(dest, got)
+		if err != nil || !filepath.IsLocal(rel) {
+			t.Fatalf("Join(%q) = %q, outside %q", name, got, dest)
+		}
+		for _, elem := range strings.Split(filepath.ToSlash(rel), "/") {
+			if !isLocalElem(elem) || strings.ContainsAny(elem, `\:`) {
+				t.Fatalf("Join(%q) = %q, unsafe element %q", name, got, elem)
+			}
+		}
+	})
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// InventoryEntry 安装程序创建的一个文件或目录
+type InventoryEntry struct {
+	Path string `json:"path"`
+	Dir  bool   `json:"dir,omitempty"`
+}
+
+// Inventory 记录安装程序创建的所有文件和目录, 卸载时只删除这些内容.
+// 多次安装会合并到同一个清单, 按创建顺序排列, 卸载时倒序删除.
+type Inventory struct {
+	InstallPath string           `json:"installPath"`
+	Version     string           `json:"version"`
+	Entries     []InventoryEntry `json:"entries"`
+}
+
+// InventoryPath 返回安装清单的路径
+func InventoryPath() string {
+	return filepath.Join(GetMyAppdataFolder(), "install.inventory")
+}
+
+// LoadInventory 读取安装清单, 不存在时返回 nil
+func LoadInventory(path string) (*Inventory, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	inventory := &Inventory{}
+	if err := json.Unmarshal(data, inventory); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return inventory, nil
+}
+
+// Merge 追加清单中还没有的条目
+func (inv *Inventory) Merge(entries []InventoryEntry) {
+	seen := make(map[string]bool)
+	for _, entry := range inv.Entries {
+		seen[strings.ToLower(entry.Path)] = true
+	}
+	for _, entry := range entries {
+		key := strings.ToLower(entry.Path)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		inv.Entries = append(inv.Entries, entry)
+	}
+}
+
+// Save 写入清单, 先写临时文件再替换, 避免留下半个文件
+func (inv *Inventory) Save(path string) error {
+	data, err := json.MarshalIndent(inv, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmpPath := path + "-"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
+
+// saveInventory 把本次安装的文件合并到磁盘上的安装清单
+func saveInventory(ic *InstallContext) error {
+	path := InventoryPath()
+	inventory, err := LoadInventory(path)
+	if err != nil {
+		return err
+	}
+	if inventory == nil {
+		inventory = &Inventory{}
+	}
+	inventory.InstallPath = ic.InstallPath
+	inventory.Version = Version
+	inventory.Merge(ic.Journal.Inventory())
+
+	// 清单本身也交给 Journal, 安装失败回滚时恢复旧的清单
+	if err := ic.Journal.Track(path); err != nil {
+		return err
+	}
+	return inventory.Save(path)
+}
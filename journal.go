@@ -0,0 +1,532 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	opCreated     = "created"
+	opOverwritten = "overwritten"
+	opDeleted     = "deleted"
+	opMkdir       = "mkdir"
+	opRmdir       = "rmdir"
+
+	// opBegin 记录本次安装的参数, opDone 记录已完成的步骤
+	opBegin = "begin"
+	opDone  = "done"
+)
+
+// 被覆盖或删除的文件先重命名为 <path>.lgt-bak, 回滚时再改回来, 提交时删除
+const backupSuffix = ".lgt-bak"
+
+// JournalEntry 一次文件系统修改或一个安装阶段
+type JournalEntry struct {
+	Op       string `json:"op"`
+	Path     string `json:"path,omitempty"`
+	Backup   string `json:"backup,omitempty"`
+	Step     string `json:"step,omitempty"`
+	Language string `json:"language,omitempty"`
+}
+
+// Journal 记录安装过程中创建、覆盖和删除的文件和目录,
+// 安装失败时倒序回放, 让安装目录和 appdata 目录恢复到安装前的样子.
+//
+// 通过 OpenJournal 打开的 Journal 会把每条记录立即追加到磁盘,
+// 安装进程被杀掉后, 下次启动可以用 LoadJournal 读回来继续安装或回滚.
+// nil Journal 不做记录, 直接操作文件系统.
+type Journal struct {
+	mu      sync.Mutex
+	entries []JournalEntry
+	tracked map[string]bool
+
+	path string
+	file *os.File
+}
+
+func NewJournal() *Journal {
+	return &Journal{tracked: make(map[string]bool)}
+}
+
+// JournalPath 返回磁盘上的安装日志路径
+func JournalPath() string {
+	return filepath.Join(GetMyAppdataFolder(), "install.journal")
+}
+
+// errUnfinishedRollback 上次安装留下的日志没能完全回滚, 不能开始新的安装
+var errUnfinishedRollback = errors.New("the previous installation could not be rolled back")
+
+// OpenJournal 创建一个新的磁盘安装日志.
+// path 上还有未撤销的记录时先回滚, 回滚失败时保留旧日志并返回 errUnfinishedRollback.
+func OpenJournal(path string, installPath string, language string) (*Journal, error) {
+	if old, err := LoadJournal(path); err != nil {
+		slog.Warn("read install journal", "path", path, "err", err)
+	} else if old.pending() {
+		slog.Warn("roll back unfinished install journal", "path", path, "install_path", old.InstallPath())
+		err := old.Rollback()
+		old.Close()
+		if err != nil {
+			return nil, errors.Join(errUnfinishedRollback, err)
+		}
+	} else {
+		old.Close()
+	}
+
+	j := NewJournal()
+	j.path = path
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	j.file = file
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.add(JournalEntry{Op: opBegin, Path: installPath, Language: language}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return j, nil
+}
+
+// LoadJournal 读取上次未完成的安装日志, 不存在时返回 nil.
+// 进程在写入时被杀掉会留下半行, 这一行会被忽略.
+func LoadJournal(path string) (*Journal, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	j := NewJournal()
+	j.path = path
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			break
+		}
+		j.entries = append(j.entries, entry)
+		j.track(entry)
+	}
+	if len(j.entries) == 0 || j.entries[0].Op != opBegin {
+		return nil, fmt.Errorf("%s: invalid install journal", path)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if err := j.rewrite(); err != nil {
+		return nil, err
+	}
+	return j, nil
+}
+
+// InstallPath 返回日志记录的安装目录
+func (j *Journal) InstallPath() string {
+	if j == nil || len(j.entries) == 0 {
+		return ""
+	}
+	return j.entries[0].Path
+}
+
+// Language 返回日志记录的安装语言
+func (j *Journal) Language() string {
+	if j == nil || len(j.entries) == 0 {
+		return ""
+	}
+	return j.entries[0].Language
+}
+
+// Completed 返回已完成的步骤
+func (j *Journal) Completed() map[string]bool {
+	completed := make(map[string]bool)
+	if j == nil {
+		return completed
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, entry := range j.entries {
+		if entry.Op == opDone {
+			completed[entry.Step] = true
+		}
+	}
+	return completed
+}
+
+// StepDone 记录一个已完成的步骤
+func (j *Journal) StepDone(step string) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.add(JournalEntry{Op: opDone, Step: step})
+}
+
+// LastDone 返回最后一个已完成步骤之后的位置, 之后的记录属于被中断的步骤
+func (j *Journal) LastDone() int {
+	if j == nil {
+		return 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(j.entries) - 1; i >= 0; i-- {
+		if j.entries[i].Op == opDone || j.entries[i].Op == opBegin {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// Len 返回当前记录数, 可作为 RollbackTo 的标记
+func (j *Journal) Len() int {
+	if j == nil {
+		return 0
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return len(j.entries)
+}
+
+// Inventory 返回本次安装创建或覆盖、并且仍然存在的文件和目录, 按创建顺序排列.
+// 临时文件和已经被删除的压缩包不会出现在结果里.
+func (j *Journal) Inventory() []InventoryEntry {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var entries []InventoryEntry
+	for _, entry := range j.entries {
+		switch entry.Op {
+		case opCreated, opOverwritten:
+			if info, err := os.Lstat(entry.Path); err == nil && !info.IsDir() {
+				entries = append(entries, InventoryEntry{Path: entry.Path})
+			}
+		case opMkdir:
+			if info, err := os.Stat(entry.Path); err == nil && info.IsDir() {
+				entries = append(entries, InventoryEntry{Path: entry.Path, Dir: true})
+			}
+		}
+	}
+	return entries
+}
+
+// add 先写磁盘再改内存, 调用方需持有锁
+func (j *Journal) add(entry JournalEntry) error {
+	if j.file != nil {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		if _, err := j.file.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if err := j.file.Sync(); err != nil {
+			return err
+		}
+	}
+	if entry.Path != "" {
+		slog.Debug("journal", "op", entry.Op, "path", entry.Path)
+	}
+	j.entries = append(j.entries, entry)
+	j.track(entry)
+	return nil
+}
+
+// track 更新 tracked, 调用方需持有锁. 被删除的路径不再算作已记录,
+// 之后重新创建时 Track 会再记一条 created, 让它出现在 Inventory 里
+func (j *Journal) track(entry JournalEntry) {
+	switch entry.Op {
+	case opBegin, opDone:
+	case opDeleted, opRmdir:
+		delete(j.tracked, entry.Path)
+	default:
+		j.tracked[entry.Path] = true
+	}
+}
+
+// rewrite 用内存中的记录替换磁盘上的日志, 调用方需持有锁
+func (j *Journal) rewrite() error {
+	if j.path == "" {
+		return nil
+	}
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+
+	var buf bytes.Buffer
+	for _, entry := range j.entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+	}
+	tmpPath := j.path + "-"
+	if err := os.WriteFile(tmpPath, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(j.path, os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	j.file = file
+	return nil
+}
+
+// Track 必须在创建或覆盖 path 之前调用.
+// 已存在的文件会被移到备份位置, 不存在的父目录会被创建并记录.
+func (j *Journal) Track(path string) error {
+	if j == nil {
+		return os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	}
+	if err := j.MkdirAll(filepath.Dir(path)); err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.tracked[path] {
+		return nil
+	}
+
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return j.add(JournalEntry{Op: opCreated, Path: path})
+	}
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s: is a directory", path)
+	}
+
+	// 先记录再移动, 进程在两者之间被杀掉时回滚会发现备份不存在而保留原文件
+	if err := j.add(JournalEntry{Op: opOverwritten, Path: path, Backup: path + backupSuffix}); err != nil {
+		return err
+	}
+	return moveToBackup(path)
+}
+
+// MkdirAll 同 os.MkdirAll, 并记录新建的每一级目录
+func (j *Journal) MkdirAll(dir string) error {
+	if j == nil {
+		return os.MkdirAll(dir, os.ModePerm)
+	}
+
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for i := len(missing) - 1; i >= 0; i-- {
+		err := os.Mkdir(missing[i], os.ModePerm)
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := j.add(JournalEntry{Op: opMkdir, Path: missing[i]}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Remove 同 os.Remove, 文件先移到备份位置, 以便回滚
+func (j *Journal) Remove(path string) error {
+	if j == nil {
+		return os.Remove(path)
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if info.IsDir() {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		return j.add(JournalEntry{Op: opRmdir, Path: path})
+	}
+
+	if err := j.add(JournalEntry{Op: opDeleted, Path: path, Backup: path + backupSuffix}); err != nil {
+		return err
+	}
+	return moveToBackup(path)
+}
+
+// Rollback 倒序撤销所有记录
+func (j *Journal) Rollback() error {
+	return j.RollbackTo(0)
+}
+
+// RollbackTo 倒序撤销 mark 之后的记录
+func (j *Journal) RollbackTo(mark int) error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var errs []error
+	for i := len(j.entries) - 1; i >= mark; i-- {
+		entry := j.entries[i]
+		if entry.Op == opBegin {
+			continue
+		}
+		if err := undoEntry(entry); err != nil {
+			slog.Error("undo journal entry", "op", entry.Op, "path", entry.Path, "err", err)
+			errs = append(errs, err)
+			// 撤销失败的记录保留在日志里, 下次启动还可以再试
+			continue
+		}
+		slog.Debug("undo journal entry", "op", entry.Op, "path", entry.Path)
+		delete(j.tracked, entry.Path)
+		j.entries = append(j.entries[:i], j.entries[i+1:]...)
+	}
+	if err := j.rewrite(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Commit 安装成功后删除所有备份和磁盘上的日志
+func (j *Journal) Commit() error {
+	if j == nil {
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	var errs []error
+	for _, entry := range j.entries {
+		if entry.Backup == "" {
+			continue
+		}
+		if err := os.Remove(entry.Backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+	j.entries = nil
+	j.tracked = make(map[string]bool)
+	if err := j.discard(); err != nil {
+		errs = append(errs, err)
+	}
+	return errors.Join(errs...)
+}
+
+// Close 关闭磁盘日志; 如果已经没有需要撤销的文件记录, 日志文件也一并删除
+func (j *Journal) Close() error {
+	if j == nil {
+		return nil
+	}
+	if j.pending() {
+		j.mu.Lock()
+		defer j.mu.Unlock()
+		if j.file != nil {
+			j.file.Close()
+			j.file = nil
+		}
+		return nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.discard()
+}
+
+// pending 判断日志中是否还有需要撤销的文件记录
+func (j *Journal) pending() bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	for _, entry := range j.entries {
+		if entry.Op != opBegin && entry.Op != opDone {
+			return true
+		}
+	}
+	return false
+}
+
+// discard 删除磁盘日志, 调用方需持有锁
+func (j *Journal) discard() error {
+	if j.file != nil {
+		j.file.Close()
+		j.file = nil
+	}
+	if j.path == "" {
+		return nil
+	}
+	if err := os.Remove(j.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+func undoEntry(entry JournalEntry) error {
+	switch entry.Op {
+	case opCreated:
+		if err := os.Remove(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	case opOverwritten, opDeleted:
+		// 备份不存在说明还没来得及移动, 原文件还在原位
+		if !FileExists(entry.Backup) {
+			return nil
+		}
+		if err := os.Remove(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		return os.Rename(entry.Backup, entry.Path)
+	case opMkdir:
+		// 目录里还有不属于本次安装的文件时保留目录
+		if dir, err := os.ReadDir(entry.Path); err == nil && len(dir) > 0 {
+			return nil
+		}
+		if err := os.Remove(entry.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	case opRmdir:
+		return os.MkdirAll(entry.Path, os.ModePerm)
+	}
+	return nil
+}
+
+func moveToBackup(path string) error {
+	backup := path + backupSuffix
+	if err := os.Remove(backup); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return os.Rename(path, backup)
+}
@@ -0,0 +1,312 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// assertFile 检查 path 的内容, content 为空字符串时检查 path 不存在
+func assertFile(t *testing.T, path string, content string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if content == "" {
+		if err == nil {
+			t.Errorf("%s exists, want it removed", path)
+		}
+		return
+	}
+	if err != nil || string(data) != content {
+		t.Errorf("%s = %q, %v, want %q", path, data, err, content)
+	}
+}
+
+func TestJournalRollback(t *testing.T) {
+	tests := []struct {
+		name   string
+		before map[string]string
+		change func(t *testing.T, j *Journal, dir string)
+		after  map[string]string
+	}{
+		{
+			name: "create file",
+			change: func(t *testing.T, j *Journal, dir string) {
+				path := filepath.Join(dir, "sub", "new.txt")
+				if err := j.Track(path); err != nil {
+					t.Fatal(err)
+				}
+				writeFile(t, path, "new")
+			},
+			after: map[string]string{"sub/new.txt": "new"},
+		},
+		{
+			name:   "overwrite file",
+			before: map[string]string{"a.txt": "old"},
+			change: func(t *testing.T, j *Journal, dir string) {
+				path := filepath.Join(dir, "a.txt")
+				if err := j.Track(path); err != nil {
+					t.Fatal(err)
+				}
+				assertFile(t, path+backupSuffix, "old")
+				writeFile(t, path, "new")
+			},
+			after: map[string]string{"a.txt": "new"},
+		},
+		{
+			name:   "overwrite twice",
+			before: map[string]string{"a.txt": "old"},
+			change: func(t *testing.T, j *Journal, dir string) {
+				path := filepath.Join(dir, "a.txt")
+				for _, content := range []string{"one", "two"} {
+					if err := j.Track(path); err != nil {
+						t.Fatal(err)
+					}
+					writeFile(t, path, content)
+				}
+			},
+			after: map[string]string{"a.txt": "two"},
+		},
+		{
+			name:   "delete file",
+			before: map[string]string{"a.txt": "old"},
+			change: func(t *testing.T, j *Journal, dir string) {
+				if err := j.Remove(filepath.Join(dir, "a.txt")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			after: map[string]string{},
+		},
+		{
+			name: "remove directory",
+			change: func(t *testing.T, j *Journal, dir string) {
+				if err := os.Mkdir(filepath.Join(dir, "d"), 0755); err != nil {
+					t.Fatal(err)
+				}
+				if err := j.Remove(filepath.Join(dir, "d")); err != nil {
+					t.Fatal(err)
+				}
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range test.before {
+				path := filepath.Join(dir, filepath.FromSlash(name))
+				os.MkdirAll(filepath.Dir(path), 0755)
+				writeFile(t, path, content)
+			}
+			j := NewJournal()
+			test.change(t, j, dir)
+			for name, content := range test.after {
+				assertFile(t, filepath.Join(dir, filepath.FromSlash(name)), content)
+			}
+
+			if err := j.Rollback(); err != nil {
+				t.Fatalf("Rollback: %v", err)
+			}
+			if j.Len() != 0 {
+				t.Errorf("Len() = %d after Rollback, want 0", j.Len())
+			}
+			// 目录恢复到修改之前的样子, 没有留下备份
+			got := map[string]string{}
+			filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+				if err == nil && !d.IsDir() {
+					rel, _ := filepath.Rel(dir, path)
+					data, _ := os.ReadFile(path)
+					got[filepath.ToSlash(rel)] = string(data)
+				}
+				return nil
+			})
+			if len(got) != len(test.before) {
+				t.Errorf("after Rollback got %v, want %v", got, test.before)
+			}
+			for name, content := range test.before {
+				if got[name] != content {
+					t.Errorf("after Rollback %s = %q, want %q", name, got[name], content)
+				}
+			}
+			if _, err := os.Stat(filepath.Join(dir, "d")); test.name == "remove directory" && err != nil {
+				t.Errorf("removed directory not restored: %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "sub")); err == nil {
+				t.Error("created directory not removed")
+			}
+		})
+	}
+}
+
+func TestJournalRollbackTo(t *testing.T) {
+	dir := t.TempDir()
+	a, b, c := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt"), filepath.Join(dir, "c.txt")
+	writeFile(t, b, "old b")
+
+	j := NewJournal()
+	j.Track(a)
+	writeFile(t, a, "a")
+	mark := j.Len()
+	j.Track(b)
+	writeFile(t, b, "new b")
+	j.Track(c)
+	writeFile(t, c, "c")
+
+	if err := j.RollbackTo(mark); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, a, "a")
+	assertFile(t, b, "old b")
+	assertFile(t, b+backupSuffix, "")
+	assertFile(t, c, "")
+	if j.Len() != mark {
+		t.Errorf("Len() = %d, want %d", j.Len(), mark)
+	}
+
+	// 撤销过的路径可以再次记录
+	j.Track(c)
+	writeFile(t, c, "c")
+	if err := j.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, a, "")
+	assertFile(t, c, "")
+}
+
+func TestJournalCommit(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "install.journal")
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFile(t, a, "old a")
+	writeFile(t, b, "old b")
+
+	j, err := OpenJournal(path, dir, "english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Track(a)
+	writeFile(t, a, "new a")
+	j.Remove(b)
+	if err := j.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, a, "new a")
+	assertFile(t, a+backupSuffix, "")
+	assertFile(t, b, "")
+	assertFile(t, b+backupSuffix, "")
+	assertFile(t, path, "")
+	if err := j.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadJournal(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "install.journal")
+	a, b := filepath.Join(dir, "a.txt"), filepath.Join(dir, "b.txt")
+	writeFile(t, b, "old b")
+
+	j, err := OpenJournal(path, dir, "german")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Track(a)
+	writeFile(t, a, "a")
+	j.StepDone("client")
+	j.Track(b)
+	writeFile(t, b, "new b")
+	j.Close()
+	complete, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		data    string
+		entries int
+	}{
+		{"complete", string(complete), 4},
+		// 进程在写入最后一行时被杀掉
+		{"half-written last line", string(complete) + `{"op":"created","pa`, 4},
+		{"missing newline", string(complete[:len(complete)-1]), 4},
+		{"truncated", string(complete[:len(complete)-10]), 3},
+	}
+	for _, test := range tests {
+		writeFile(t, path, test.data)
+		j, err := LoadJournal(path)
+		if err != nil {
+			t.Errorf("%s: LoadJournal: %v", test.name, err)
+			continue
+		}
+		if j.Len() != test.entries || j.InstallPath() != dir || j.Language() != "german" || !j.Completed()["client"] {
+			t.Errorf("%s: got %d entries, path %q, language %q, completed %v", test.name, j.Len(), j.InstallPath(), j.Language(), j.Completed())
+		}
+		j.Close()
+		// 读取时去掉半行, 之后追加的记录不会和它连在一起
+		if data, _ := os.ReadFile(path); len(data) == 0 || data[len(data)-1] != '\n' {
+			t.Errorf("%s: journal not rewritten: %q", test.name, data)
+		}
+	}
+
+	// 继续安装前撤销被中断的步骤
+	writeFile(t, path, string(complete))
+	j, err = LoadJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.RollbackTo(j.LastDone()); err != nil {
+		t.Fatal(err)
+	}
+	assertFile(t, a, "a")
+	assertFile(t, b, "old b")
+	if err := j.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	j.Close()
+	assertFile(t, a, "")
+	assertFile(t, path, "")
+
+	for _, data := range []string{"", "not json\n", `{"op":"created","path":"x"}` + "\n"} {
+		writeFile(t, path, data)
+		if _, err := LoadJournal(path); err == nil {
+			t.Errorf("LoadJournal(%q) = nil error, want invalid journal", data)
+		}
+	}
+	os.Remove(path)
+	if j, err := LoadJournal(path); j != nil || err != nil {
+		t.Errorf("LoadJournal(missing) = %v, %v, want nil", j, err)
+	}
+}
+
+func TestOpenJournalRollsBackPrevious(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "install.journal")
+	a := filepath.Join(dir, "a.txt")
+	writeFile(t, a, "old")
+
+	j, err := OpenJournal(path, dir, "english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	j.Track(a)
+	writeFile(t, a, "new")
+	j.Close()
+
+	// 新的安装不能覆盖还有未撤销记录的日志
+	j, err = OpenJournal(path, dir, "english")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer j.Close()
+	assertFile(t, a, "old")
+	assertFile(t, a+backupSuffix, "")
+	if j.Len() != 1 {
+		t.Errorf("Len() = %d, want only the begin entry", j.Len())
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"runtime"
+)
+
+// ExtractLimits 解压时的资源限制, 防止损坏或恶意的压缩包(解压炸弹)写满磁盘或耗尽内存.
+// 值为 0 表示不限制.
+type ExtractLimits struct {
+	// MaxTotalSize 一个压缩包解压后的总大小
+	MaxTotalSize int64
+	// MaxFileSize 单个文件解压后的大小
+	MaxFileSize int64
+	// MaxFiles 一个压缩包中的文件数
+	MaxFiles int
+	// MaxRatio 解压后大小和压缩后大小的比例, 只检查大于 RatioMinSize 的文件
+	MaxRatio     float64
+	RatioMinSize int64
+
+	// Workers 并行解压的协程数, MemoryBudget 同时在解压中的文件大小之和
+	Workers      int
+	MemoryBudget int64
+}
+
+// DefaultExtractLimits 默认限制, 内嵌压缩包中最大的是 CEF 的 libcef.dll, 远小于这些值.
+// 最多用 8 个协程解压, 再多瓶颈就在磁盘上了
+var DefaultExtractLimits = ExtractLimits{
+	MaxTotalSize: 4 << 30,
+	MaxFileSize:  1 << 30,
+	MaxFiles:     20000,
+	MaxRatio:     200,
+	RatioMinSize: 1 << 20,
+	Workers:      min(runtime.NumCPU(), 8),
+	MemoryBudget: 256 << 20,
+}
+
+// archiveLimits 在解压之前按压缩包中声明的大小检查限制
+type archiveLimits struct {
+	limits ExtractLimits
+	files  int
+	total  int64
+}
+
+// check 检查一个文件声明的大小, compressed 未知时传 -1, 不检查压缩比
+func (a *archiveLimits) check(name string, size int64, compressed int64) error {
+	l := a.limits
+	a.files++
+	a.total += size
+	if size < 0 {
+		return &LimitError{Name: name, Limit: "file size", Value: size}
+	}
+	if l.MaxFiles > 0 && a.files > l.MaxFiles {
+		return &LimitError{Name: name, Limit: "file count", Value: int64(a.files), Max: int64(l.MaxFiles)}
+	}
+	if l.MaxFileSize > 0 && size > l.MaxFileSize {
+		return &LimitError{Name: name, Limit: "file size", Value: size, Max: l.MaxFileSize}
+	}
+	if l.MaxTotalSize > 0 && a.total > l.MaxTotalSize {
+		return &LimitError{Name: name, Limit: "total size", Value: a.total, Max: l.MaxTotalSize}
+	}
+	if compressed >= 0 {
+		return a.checkRatio(name, size, compressed)
+	}
+	return nil
+}
+
+// checkRatio 检查解压后大小 size 和压缩后大小 compressed 的比例
+func (a *archiveLimits) checkRatio(name string, size int64, compressed int64) error {
+	l := a.limits
+	if l.MaxRatio <= 0 || size <= l.RatioMinSize {
+		return nil
+	}
+	if compressed <= 0 || float64(size)/float64(compressed) > l.MaxRatio {
+		ratio := size
+		if compressed > 0 {
+			ratio = size / compressed
+		}
+		return &LimitError{Name: name, Limit: "compression ratio", Value: ratio, Max: int64(l.MaxRatio)}
+	}
+	return nil
+}
+
+// checkedReader 读取压缩包中的一个文件, 实际读到的字节数必须等于声明的大小, 读完后校验 CRC32.
+// 不依赖解压库自己的校验: archive/zip 在 CRC32 字段为 0 时不会校验.
+// 读取出错时错误信息中带有文件名.
+type checkedReader struct {
+	r        io.Reader
+	name     string
+	size     int64
+	crc      uint32
+	checkCRC bool
+	read     int64
+	hash     hash.Hash32
+}
+
+// newCheckedReader checkCRC 为 false 时只检查大小, 用于没有记录 CRC32 的文件
+func newCheckedReader(r io.Reader, name string, size int64, crc uint32, checkCRC bool) *checkedReader {
+	return &checkedReader{r: r, name: name, size: size, crc: crc, checkCRC: checkCRC, hash: crc32.NewIEEE()}
+}
+
+func (c *checkedReader) Read(p []byte) (int, error) {
+	// 多读一个字节, 用来发现实际内容比声明的大
+	if remain := c.size - c.read + 1; int64(len(p)) > remain {
+		p = p[:remain]
+	}
+	n, err := c.r.Read(p)
+	c.read += int64(n)
+	c.hash.Write(p[:n])
+	if c.read > c.size {
+		return n, &LimitError{Name: c.name, Limit: "declared size", Value: c.read, Max: c.size}
+	}
+	if errors.Is(err, io.EOF) {
+		if c.read != c.size {
+			return n, fmt.Errorf("%s: %w: read %d bytes, expected %d", c.name, io.ErrUnexpectedEOF, c.read, c.size)
+		}
+		if sum := c.hash.Sum32(); c.checkCRC && sum != c.crc {
+			return n, fmt.Errorf("%s: %w: %08x, expected %08x", c.name, zip.ErrChecksum, sum, c.crc)
+		}
+	} else if err != nil {
+		return n, fmt.Errorf("%s: %w", c.name, err)
+	}
+	return n, err
+}
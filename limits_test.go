@@ -0,0 +1,105 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"hash/crc32"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestArchiveLimits(t *testing.T) {
+	limits := ExtractLimits{MaxTotalSize: 100, MaxFileSize: 60, MaxFiles: 3, MaxRatio: 10, RatioMinSize: 20}
+	type file struct {
+		size, compressed int64
+	}
+	tests := []struct {
+		name  string
+		files []file
+		limit string
+	}{
+		{"within limits", []file{{60, 6}, {30, -1}, {10, 0}}, ""},
+		{"file size", []file{{61, 61}}, "file size"},
+		{"negative size", []file{{-1, 0}}, "file size"},
+		{"file count", []file{{1, 1}, {1, 1}, {1, 1}, {1, 1}}, "file count"},
+		{"total size", []file{{60, 60}, {41, 41}}, "total size"},
+		{"compression ratio", []file{{50, 4}}, "compression ratio"},
+		{"zero compressed size", []file{{50, 0}}, "compression ratio"},
+		// 小文件和压缩后大小未知的文件不检查压缩比
+		{"small file", []file{{20, 1}}, ""},
+		{"unknown compressed size", []file{{50, -1}}, ""},
+	}
+	for _, test := range tests {
+		a := &archiveLimits{limits: limits}
+		var err error
+		for i, f := range test.files {
+			if err = a.check("f", f.size, f.compressed); err != nil {
+				if i != len(test.files)-1 {
+					t.Errorf("%s: file %d: %v", test.name, i, err)
+				}
+				break
+			}
+		}
+		var limitErr *LimitError
+		switch {
+		case test.limit == "" && err != nil:
+			t.Errorf("%s: check = %v, want nil", test.name, err)
+		case test.limit != "" && (!errors.As(err, &limitErr) || limitErr.Limit != test.limit || !errors.Is(err, ErrLimit)):
+			t.Errorf("%s: check = %v, want %s limit", test.name, err, test.limit)
+		}
+	}
+
+	// 值为 0 表示不限制
+	a := &archiveLimits{}
+	for range 10 {
+		if err := a.check("f", 1<<40, 1); err != nil {
+			t.Errorf("check without limits = %v", err)
+		}
+	}
+}
+
+func TestCheckedReader(t *testing.T) {
+	data := []byte("hello, world")
+	crc := crc32.ChecksumIEEE(data)
+	tests := []struct {
+		name     string
+		r        io.Reader
+		size     int64
+		crc      uint32
+		checkCRC bool
+		want     error
+	}{
+		{"ok", bytes.NewReader(data), int64(len(data)), crc, true, nil},
+		{"one byte at a time", iotest.OneByteReader(bytes.NewReader(data)), int64(len(data)), crc, true, nil},
+		{"empty", bytes.NewReader(nil), 0, 0, true, nil},
+		{"more than declared", bytes.NewReader(data), int64(len(data)) - 1, crc, true, ErrLimit},
+		{"declared empty", bytes.NewReader(data), 0, crc, true, ErrLimit},
+		{"less than declared", bytes.NewReader(data), int64(len(data)) + 1, crc, true, io.ErrUnexpectedEOF},
+		{"crc mismatch", bytes.NewReader(data), int64(len(data)), crc + 1, true, zip.ErrChecksum},
+		{"crc not checked", bytes.NewReader(data), int64(len(data)), 0, false, nil},
+		{"read error", iotest.ErrReader(context.Canceled), int64(len(data)), crc, true, context.Canceled},
+	}
+	for _, test := range tests {
+		r := newCheckedReader(test.r, "dir/f.txt", test.size, test.crc, test.checkCRC)
+		got, err := io.ReadAll(r)
+		if test.want == nil {
+			if err != nil || !bytes.Equal(got, data[:test.size]) {
+				t.Errorf("%s: ReadAll = %q, %v, want %q", test.name, got, err, data[:test.size])
+			}
+			continue
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: ReadAll error = %v, want %v", test.name, err, test.want)
+		}
+		// 错误信息中带有文件名
+		if err != nil && !bytes.Contains([]byte(err.Error()), []byte("dir/f.txt")) {
+			t.Errorf("%s: error %q does not name the file", test.name, err)
+		}
+		if int64(len(got)) > test.size+1 {
+			t.Errorf("%s: read %d bytes, declared %d", test.name, len(got), test.size)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// 日志文件超过 logMaxSize 时改名为 installer.log.1, 最多保留 logBackups 个旧文件
+const (
+	logMaxSize = 5 << 20
+	logBackups = 3
+)
+
+// defaultLogPath 默认的日志文件, 放在 %APPDATA%\luckygametools 下, 卸载时随 --purge 删除
+func defaultLogPath() string {
+	return filepath.Join(GetMyAppdataFolder(), "installer.log")
+}
+
+// logFile setupLogging 打开的日志文件, 没有打开时为 nil
+var logFile *rotatingFile
+
+// parseLogLevel 解析 --log-level, 可以是 debug, info, warn 或 error
+func parseLogLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level: %s", s)
+	}
+	return level, nil
+}
+
+// setupLogging 把 slog 和 log 的输出写到日志文件, 返回关闭日志文件的函数.
+// 日志文件打不开时输出到 stderr, 安装照常进行.
+func setupLogging(opts *Options) func() {
+	level, err := parseLogLevel(opts.LogLevel)
+	if err != nil {
+		level = slog.LevelInfo
+	}
+	path := opts.LogFile
+	if path == "" {
+		path = defaultLogPath()
+	}
+
+	var w io.Writer = os.Stderr
+	closeLog := func() {}
+	file, err := openRotatingFile(path, logMaxSize, logBackups)
+	if err == nil {
+		w = file
+		logFile = file
+		closeLog = func() { file.Close() }
+	}
+
+	handlerOptions := &slog.HandlerOptions{Level: level}
+	if !opts.NoRedact {
+		// 用户目录的名字经常和用户名不同, 例如改过名的账户、Microsoft 账户和 user.DOMAIN
+		profile := ""
+		if userProfile := os.Getenv("USERPROFILE"); userProfile != "" {
+			profile = filepath.Base(userProfile)
+		}
+		handlerOptions.ReplaceAttr = newRedactor(os.Getenv("USERNAME"), profile, GetHostName()).replaceAttr
+	}
+	slog.SetDefault(slog.New(slog.NewTextHandler(w, handlerOptions)))
+	if err != nil {
+		slog.Warn("open log file", "path", path, "err", err)
+	}
+	slog.Info("installer started", "version", Version, "args", os.Args[1:], "admin", IsAdmin())
+	return closeLog
+}
+
+// closeLogFile 关闭日志文件, 之后的日志输出到 stderr. --purge 删除 appdata 目录前调用,
+// Windows 上打开中的文件不能删除
+func closeLogFile() {
+	if logFile == nil {
+		return
+	}
+	slog.Info("close log file before removing the app data folder")
+	logFile.Close()
+	logFile = nil
+	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, nil)))
+}
+
+// redactor 把日志中的用户名、用户目录名和计算机名替换为 <user> 和 <host>, 让日志可以放心地发给别人.
+// 只替换完整的单词, 不区分大小写, 和 Windows 路径一致.
+type redactor struct {
+	patterns     []*regexp.Regexp
+	replacements []string
+}
+
+func newRedactor(username string, profile string, hostname string) *redactor {
+	r := &redactor{}
+	for _, secret := range []struct{ value, replacement string }{
+		// 用户目录名可能包含用户名 (john.CORP), 先替换较长的
+		{profile, "<user>"},
+		{username, "<user>"},
+		{hostname, "<host>"},
+	} {
+		// 太短的名字会误伤正常的内容
+		if len(secret.value) < 2 {
+			continue
+		}
+		r.patterns = append(r.patterns, regexp.MustCompile(`(?i)`+regexp.QuoteMeta(secret.value)))
+		r.replacements = append(r.replacements, secret.replacement)
+	}
+	return r
+}
+
+// redact 替换 s 中的用户名、用户目录名和计算机名
+func (r *redactor) redact(s string) string {
+	for i, pattern := range r.patterns {
+		s = replaceWord(s, pattern, r.replacements[i])
+	}
+	return s
+}
+
+// replaceWord 把 s 中前后都不是字母、数字或下划线的 pattern 替换为 replacement.
+// 边界字符不属于匹配的内容, 所以 C:\Users\bob\bob 中的两个 bob 都会被替换.
+func replaceWord(s string, pattern *regexp.Regexp, replacement string) string {
+	var b strings.Builder
+	done := 0
+	for start := 0; start < len(s); {
+		loc := pattern.FindStringIndex(s[start:])
+		if loc == nil {
+			break
+		}
+		begin, end := start+loc[0], start+loc[1]
+		before, _ := utf8.DecodeLastRuneInString(s[:begin])
+		after, _ := utf8.DecodeRuneInString(s[end:])
+		if begin > 0 && isWordRune(before) || end < len(s) && isWordRune(after) {
+			// 不是完整的单词, 从下一个字符继续找
+			_, size := utf8.DecodeRuneInString(s[begin:])
+			start = begin + size
+			continue
+		}
+		b.WriteString(s[done:begin])
+		b.WriteString(replacement)
+		done, start = end, end
+	}
+	if done == 0 {
+		return s
+	}
+	b.WriteString(s[done:])
+	return b.String()
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// replaceAttr 用于 slog.HandlerOptions, 处理消息和所有字符串、错误、列表类型的值
+func (r *redactor) replaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(r.patterns) == 0 {
+		return a
+	}
+	switch a.Value.Kind() {
+	case slog.KindString:
+		a.Value = slog.StringValue(r.redact(a.Value.String()))
+	case slog.KindAny:
+		switch v := a.Value.Any().(type) {
+		case error:
+			a.Value = slog.StringValue(r.redact(v.Error()))
+		case fmt.Stringer:
+			a.Value = slog.StringValue(r.redact(v.String()))
+		case []string:
+			a.Value = slog.StringValue(r.redact(strings.Join(v, " ")))
+		}
+	}
+	return a
+}
+
+// rotatingFile 追加写入的日志文件, 超过 maxSize 时把旧内容依次改名为 <path>.1 .. <path>.<backups>
+type rotatingFile struct {
+	mu      sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return 0, os.ErrClosed
+	}
+	if r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate 调用方需持有锁
+func (r *rotatingFile) rotate() error {
+	r.file.Close()
+	r.file = nil
+	for i := r.backups - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+	}
+	if r.backups > 0 {
+		os.Rename(r.path, r.path+".1")
+	} else {
+		os.Remove(r.path)
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return nil
+	}
+	err := r.file.Close()
+	r.file = nil
+	return err
+}
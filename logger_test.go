@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"log/slog"
+	"testing"
+)
+
+func TestRedact(t *testing.T) {
+	r := newRedactor("bob", "bob.CORP", "DESKTOP-42")
+	tests := []struct {
+		in, want string
+	}{
+		{`C:\Users\bob\AppData`, `C:\Users\<user>\AppData`},
+		// 相邻的两个名字只隔一个字符
+		{`C:\Users\bob\bob`, `C:\Users\<user>\<user>`},
+		{`bob,bob`, `<user>,<user>`},
+		{`bob bob bob`, `<user> <user> <user>`},
+		{`BOB and Bob`, `<user> and <user>`},
+		// 用户目录名整个替换, 不留下 .CORP
+		{`C:\Users\bob.CORP\Desktop`, `C:\Users\<user>\Desktop`},
+		{`C:\Users\BOB.corp\bob.corp`, `C:\Users\<user>\<user>`},
+		{`\\desktop-42\share on DESKTOP-42`, `\\<host>\share on <host>`},
+		// 名字只是单词的一部分时保留
+		{`bobby`, `bobby`},
+		{`kabob`, `kabob`},
+		{`bob_x x_bob bob2`, `bob_x x_bob bob2`},
+		{`bobby bob`, `bobby <user>`},
+		{`émbob bob`, `émbob <user>`},
+		{``, ``},
+	}
+	for _, test := range tests {
+		if got := r.redact(test.in); got != test.want {
+			t.Errorf("redact(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestRedactShortNames(t *testing.T) {
+	r := newRedactor("a", "", "")
+	if got := r.redact("a b a"); got != "a b a" {
+		t.Errorf("redact = %q, want it unchanged", got)
+	}
+	if a := slog.String("msg", "a"); r.replaceAttr(nil, a).Value.String() != "a" {
+		t.Error("replaceAttr changed the value without names")
+	}
+}
+
+func TestRedactReplaceAttr(t *testing.T) {
+	r := newRedactor("bob", "", "host")
+	tests := []struct {
+		attr slog.Attr
+		want string
+	}{
+		{slog.String("path", `C:\Users\bob`), `C:\Users\<user>`},
+		{slog.Any("err", errors.New(`open C:\Users\Bob\x: denied`)), `open C:\Users\<user>\x: denied`},
+		{slog.Any("args", []string{"--path", `C:\Users\bob\bob`}), `--path C:\Users\<user>\<user>`},
+		{slog.Int("n", 1), "1"},
+	}
+	for _, test := range tests {
+		if got := r.replaceAttr(nil, test.attr).Value.String(); got != test.want {
+			t.Errorf("replaceAttr(%v) = %q, want %q", test.attr, got, test.want)
+		}
+	}
+}
@@ -2,22 +2,26 @@ package main
 
 import (
 	"archive/zip"
+	"bytes"
+	"context"
 	_ "embed"
+	"errors"
 	"fmt"
 	"github.com/go-ole/go-ole"
-	"unicode/utf16"
+	"log/slog"
 
+	"github.com/bodgit/sevenzip"
 	"github.com/go-ole/go-ole/oleutil"
 	"github.com/lxn/walk"
 	. "github.com/lxn/walk/declarative"
 	"github.com/lxn/win"
 	"golang.org/x/sys/windows"
 	"io"
-	"log"
+	"luckygametools/internal/locale"
+	"luckygametools/internal/safepath"
+	"math"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -34,13 +38,13 @@ cd installer 到当前目录后
 
 	https://github.com/upx/upx
 
-生成ico syso文件: go generate
+生成ico syso文件和压缩包清单 exe/manifest.json: go generate (压缩包更新后都要重新生成)
 构建：
 1: set GOARCH=amd64  |  go env -w GOARCH=amd64  go env -w CGO_ENABLED=1   go env -w GOPROXY=https://goproxy.cn
 1.1: 修改版本信息 编译文件 versioninfo.json
 1.2: go generate
 
-2: go  build  -ldflags="-H windowsgui" -trimpath -o ../LuckyGameToolsInstaller.exe
+2: go  build  -ldflags="-H windowsgui -X main.Version=6.0.0.0" -trimpath -o ../LuckyGameToolsInstaller.exe
 
 note: -s：去掉符号表（symbol table）和调试信息 360会报毒
 */
@@ -50,9 +54,6 @@ var i18n = "english"
 //go:embed exe/GamePower.zip
 var GamePowerZip []byte
 
-//go:embed cef/7z.zip
-var z7 []byte
-
 //go:embed cef/cef84-min.7z
 var cef7Zip []byte
 
@@ -65,13 +66,57 @@ var appdataZip []byte
 //go:generate goversioninfo -icon=main.ico -manifest=main.manifest -64 -o main.syso
 
 func main() {
+	opts, err := parseOptions(os.Args[1:])
+	if err != nil {
+		// 参数有错也要写结果文件, 否则调用方只能看到退出码
+		if resultFile := flagValue(os.Args[1:], "result-file"); resultFile != "" {
+			newUsageResult(err).Write(resultFile)
+		}
+		os.Exit(ExitUsage)
+	}
+	closeLog := setupLogging(opts)
+	exit := func(code int) {
+		slog.Info("installer exited", "code", code)
+		closeLog()
+		os.Exit(code)
+	}
+	if opts.Uninstall {
+		exit(runUninstall(opts))
+	}
+	if opts.Repair {
+		exit(runRepair(opts))
+	}
+	if opts.Silent {
+		exit(runSilent(opts))
+	}
+
 	i18n = GetLocale()
+	if opts.Lang != "" {
+		i18n = opts.Lang
+	}
 
+	// 先加载翻译, 询问是否继续上次安装的对话框也使用用户的语言
 	i18n = InitI18n(i18n)
+
+	resume, err := checkInterruptedInstall()
+	if err != nil {
+		result := newInstallResult(resume.InstallPath(), time.Now(), err, nil)
+		result.Write(opts.ResultFile)
+		exit(result.ExitCode)
+	}
+	if resume != nil && resume.Language() != "" && resume.Language() != i18n {
+		i18n = InitI18n(resume.Language())
+	}
+
 	var mw *walk.Dialog
+	var installPathLabel *walk.Label
 	var installPathEdit *walk.LineEdit
+	var choosePathButton *walk.PushButton
 	var pb *walk.ProgressBar
+	var progressLabel *walk.Label
 	var pt *walk.PushButton
+	var cancelButton *walk.PushButton
+	var cancelInstall context.CancelCauseFunc
 	var width = 800
 	var height = 200
 	var cb *walk.ComboBox
@@ -80,23 +125,95 @@ func main() {
 
 	currentLangsIndex := GetLocaleCodeIndex(i18n)
 
-	programFilesDir := os.Getenv("ProgramFiles")
-	if programFilesDir == "" {
-		programFilesDir = "C:\\Program Files"
-	}
-
-	// 获取所有的逻辑驱动器
-	drives, err := walk.DriveNames()
-	if err == nil {
-		if len(drives) > 1 {
-			for _, drive := range drives {
-				if !strings.HasPrefix(programFilesDir, drive) {
-					programFilesDir = strings.Replace(programFilesDir, programFilesDir[0:3], drive, 1)
-					break
+	installPath := defaultInstallPath()
+	if opts.Path != "" {
+		installPath = opts.Path
+	}
+	if resume != nil {
+		installPath = resume.InstallPath()
+	}
+
+	// 关闭窗口时按最后一次安装的结果退出, 没有安装过视为用户取消.
+	// lastResult、installing 和 closeRequested 只在界面线程中读写
+	lastResult := newInstallResult(installPath, time.Now(), ErrCancelled, nil)
+	installing := false
+	closeRequested := false
+
+	// retranslate 切换语言后重新设置界面上所有的文字, 之后弹出的对话框也使用新的语言
+	retranslate := func() {
+		mw.SetTitle(Text("Installer"))
+		installPathLabel.SetText(Text("Installer Path") + ":")
+		choosePathButton.SetText(Text("Choose Installer Path"))
+		pt.SetText(Text("Install"))
+		pt.SetToolTipText(Text("Please Exit the LuckyGameTools Client and Steam Before Installation"))
+		cancelButton.SetText(Text("Cancel"))
+	}
+
+	// startInstall 在界面线程中调用, 安装协程只通过 mw.Synchronize 操作界面
+	startInstall := func(resume *Journal) {
+		pt.SetEnabled(false)
+		// 安装使用开始时选择的语言, 安装过程中不能再切换
+		cb.SetEnabled(false)
+		timeoutCtx, cancelTimeout := opts.context()
+		ctx, cancel := context.WithCancelCause(timeoutCtx)
+		cancelInstall = cancel
+		cancelButton.SetEnabled(true)
+		installing = true
+		ic := newInstallContext(installPathEdit.Text(), i18n)
+		opts.apply(ic)
+		ic.Context = ctx
+		ic.Progress = NewProgress(func(status ProgressStatus) {
+			mw.Synchronize(func() {
+				pb.SetValue(status.Percent)
+				progressLabel.SetText(status.Text())
+			})
+		})
+		go func() {
+			defer cancelTimeout()
+			start := time.Now()
+			warnings, err := installProgram(ic, resume)
+			if err != nil {
+				var elevate *elevateError
+				if errors.As(err, &elevate) && runAsAdmin(os.Args[1:]) {
+					exit(ExitSuccess)
 				}
+			} else if !ic.NoLaunch {
+				time.Sleep(time.Second * 2)
 			}
-		}
+			result := newInstallResult(ic.InstallPath, start, err, warnings)
+
+			// 放到进度回调之后执行, 否则还在排队的进度会再把进度条推上去
+			mw.Synchronize(func() {
+				installing = false
+				lastResult = result
+				cancelButton.SetEnabled(false)
+				// 安装中关闭窗口时已经回滚完毕, 不再弹出提示
+				if closeRequested {
+					mw.Close(walk.DlgCmdCancel)
+					return
+				}
+				if err != nil {
+					pb.SetValue(0)
+					progressLabel.SetText("")
+					cb.SetEnabled(true)
+					if errors.Is(err, ErrCancelled) {
+						walk.MsgBox(mw, Text("Installer"), errorMessage(err), walk.MsgBoxIconInformation|walk.MsgBoxTopMost)
+					} else {
+						walk.MsgBox(mw, Text("Error"), errorMessage(err), walk.MsgBoxIconError|walk.MsgBoxTopMost)
+					}
+					pt.SetEnabled(true)
+					return
+				}
 
+				for _, warning := range warnings {
+					walk.MsgBox(mw, Text("Error"), errorMessage(warning), walk.MsgBoxIconError|walk.MsgBoxTopMost)
+				}
+				if ic.NoLaunch {
+					walk.MsgBox(mw, Text("Complete"), Text("Installation complete"), walk.MsgBoxIconInformation|walk.MsgBoxTopMost)
+				}
+				mw.Close(walk.DlgCmdOK)
+			})
+		}()
 	}
 
 	Dialog{
@@ -111,15 +228,17 @@ func main() {
 				Layout: Grid{Columns: 3, MarginsZero: true},
 				Children: []Widget{
 					Label{
-						Text: Text("Installer Path") + ":",
+						AssignTo: &installPathLabel,
+						Text:     Text("Installer Path") + ":",
 					},
 					LineEdit{
 						AssignTo: &installPathEdit,
-						Text:     programFilesDir + "\\LuckyGameTools",
+						Text:     installPath,
 						ReadOnly: true,
 					},
 					PushButton{
-						Text: Text("Choose Installer Path"),
+						AssignTo: &choosePathButton,
+						Text:     Text("Choose Installer Path"),
 						OnClicked: func() {
 							dlg := new(walk.FileDialog)
 							dlg.Title = Text("Choose Installer Path")
@@ -141,22 +260,27 @@ func main() {
 				CurrentIndex: currentLangsIndex, // 預設選擇第一個語言
 				OnCurrentIndexChanged: func() {
 					selected := cb.Text()
-					i18n = GetLocaleLangsCode(selected)
+					i18n = InitI18n(GetLocaleLangsCode(selected))
+					retranslate()
 				},
 			},
 			PushButton{
 				AssignTo:    &pt,
+				Enabled:     false, // 自检通过后才能安装
 				Text:        Text("Install"),
 				ToolTipText: Text("Please Exit the LuckyGameTools Client and Steam Before Installation"),
 				OnClicked: func() {
-					pt.SetEnabled(false)
-					go func() {
-						installPath := installPathEdit.Text()
-						if ret := installProgram(installPath, pb); ret != "" {
-							walk.MsgBox(mw, Text("Error"), ret, walk.MsgBoxIconError|walk.MsgBoxTopMost)
-							pt.SetEnabled(true)
-						}
-					}()
+					startInstall(nil)
+				},
+			},
+			PushButton{
+				AssignTo: &cancelButton,
+				Enabled:  false, // 安装开始后才能取消
+				Text:     Text("Cancel"),
+				OnClicked: func() {
+					// 解压在一秒内停下, 已写入的文件由安装协程回滚
+					cancelButton.SetEnabled(false)
+					cancelInstall(ErrCancelled)
 				},
 			},
 			ProgressBar{
@@ -165,17 +289,78 @@ func main() {
 				MinValue: 0,
 				MaxValue: 100,
 			},
+			Label{
+				AssignTo:      &progressLabel,
+				EllipsisMode:  EllipsisPath,
+				TextAlignment: AlignNear,
+			},
 		},
 	}.Create(nil)
 
+	// 安装中关闭窗口等同于取消, 等安装协程回滚完成后再关闭, 之后才写结果文件
+	mw.Closing().Attach(func(canceled *bool, reason walk.CloseReason) {
+		if !installing {
+			return
+		}
+		*canceled = true
+		if !closeRequested {
+			closeRequested = true
+			cancelButton.SetEnabled(false)
+			cancelInstall(ErrCancelled)
+		}
+	})
+
 	WindowDisableChangeSize(mw.Handle())
 	//win.SetWindowLong(mw.Handle(), win.GWL_EXSTYLE, win.GetWindowLong(mw.Handle(), win.GWL_EXSTYLE)|win.WS_EX_TOOLWINDOW)
 	CenterWindow(mw.Handle(), width, height)
 
+	// 计算内嵌数据的哈希需要一点时间, 放到后台, 窗口先显示出来
+	go func() {
+		err := verifyEmbedded()
+		mw.Synchronize(func() {
+			if err != nil {
+				lastResult = newInstallResult(installPath, time.Now(), err, nil)
+				walk.MsgBox(mw, Text("Error"), errorMessage(err), walk.MsgBoxIconError|walk.MsgBoxTopMost)
+				return
+			}
+			pt.SetEnabled(true)
+			if resume != nil {
+				startInstall(resume)
+			}
+		})
+	}()
+
 	mw.Run()
+
+	lastResult.Write(opts.ResultFile)
+	exit(lastResult.ExitCode)
 }
 
-func runAsAdmin() bool {
+// defaultInstallPath 默认安装到 Program Files, 有多个盘时优先放到非系统盘
+func defaultInstallPath() string {
+	programFilesDir := os.Getenv("ProgramFiles")
+	if programFilesDir == "" {
+		programFilesDir = "C:\\Program Files"
+	}
+
+	// 获取所有的逻辑驱动器
+	drives, err := walk.DriveNames()
+	if err == nil {
+		if len(drives) > 1 {
+			for _, drive := range drives {
+				if !strings.HasPrefix(programFilesDir, drive) {
+					programFilesDir = strings.Replace(programFilesDir, programFilesDir[0:3], drive, 1)
+					break
+				}
+			}
+		}
+
+	}
+	return programFilesDir + "\\LuckyGameTools"
+}
+
+// runAsAdmin 以管理员权限重新启动自己, args 中的相对路径转为绝对路径后传给新进程
+func runAsAdmin(args []string) bool {
 	executablePath, err := os.Executable()
 	if err != nil {
 		return false
@@ -193,12 +378,13 @@ func runAsAdmin() bool {
 		return false
 	}
 	exePath := realPath
+	wd, _ := os.Getwd()
 
 	execute := win.ShellExecute(0,
 		win.StringToBSTR("runas"),
 		win.StringToBSTR(exePath),
-		win.StringToBSTR(""),
-		win.StringToBSTR(""),
+		win.StringToBSTR(joinArgs(absArgs(args))),
+		win.StringToBSTR(wd),
 		win.SW_SHOWNORMAL)
 	if !execute {
 		return false
@@ -233,192 +419,6 @@ func WindowDisableChangeSize(w win.HWND) {
 	win.SetWindowLong(w, win.GWL_STYLE, newStyle)
 }
 
-func installProgram(installPath string, pb *walk.ProgressBar) string {
-	//os.RemoveAll(installPath)
-	dir, err := os.ReadDir(installPath)
-
-	if err == nil {
-		for _, dirFile := range dir {
-			if dirFile.IsDir() && dirFile.Name() == "webcache" {
-
-			} else {
-				os.Remove(filepath.Join(installPath, dirFile.Name()))
-			}
-		}
-	}
-
-	// 创建安装目录
-	err = os.MkdirAll(installPath, os.ModePerm)
-
-	var isSystemPath = false
-	systemDrive := os.Getenv("SystemDrive")
-	if systemDrive != "" {
-		if strings.HasPrefix(installPath, systemDrive) {
-			isSystemPath = true
-		}
-	}
-
-	if err != nil {
-		if runAsAdmin() {
-			os.Exit(0)
-		} else {
-			return Text("Create Directory") + " " + installPath + " " + Text("Error") + " :" + err.Error()
-		}
-	}
-
-	if IsRuning("GamePower.exe") || IsRuning("steam.exe") || IsRuning("steamwebhelper.exe") {
-		return Text("Please Exit the LuckyGameTools Client and Steam Before Installation")
-	}
-
-	configJsonPath := filepath.Join(GetMyAppdataFolder(), "config.json")
-	xor := Xor(configJsonDatLocal, []byte(GetHostName()))
-	err = os.WriteFile(configJsonPath, xor, os.ModePerm)
-	if err != nil {
-		println(Text("Copy") + " " + Text("File") + " " + Text("Error") + " :" + err.Error() + "\r\n" + Text("You can try running with administrator privileges by right clicking"))
-	}
-	pb.SetValue(2)
-
-	//GamePower.tmp.exe
-	kitTmpExe := [17]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x2E, 0x74, 0x6D, 0x70, 0x2E, 0x65, 0x78, 0x65}
-	//GamePowerGui.tmp.exe
-	guiTmpExe := [20]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x47, 0x75, 0x69, 0x2E, 0x74, 0x6D, 0x70, 0x2E, 0x65, 0x78, 0x65}
-
-	/*//steamPower.dll
-	steamPowerDll := [14]uint8{0x73, 0x74, 0x65, 0x61, 0x6D, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x2E, 0x64, 0x6C, 0x6C}
-
-	os.Remove(filepath.Join(GetMyAppdataFolder(), string(steamPowerDll[:])))*/
-
-	os.Remove(filepath.Join(GetMyAppdataFolder(), string(kitTmpExe[:])))
-	os.Remove(filepath.Join(GetMyAppdataFolder(), string(kitTmpExe[:])) + "-")
-	os.Remove(filepath.Join(GetMyAppdataFolder(), string(kitTmpExe[:])) + ".bak")
-
-	os.Remove(filepath.Join(GetMyAppdataFolder(), string(guiTmpExe[:])))
-	os.Remove(filepath.Join(GetMyAppdataFolder(), string(guiTmpExe[:])) + "-")
-	os.Remove(filepath.Join(GetMyAppdataFolder(), string(guiTmpExe[:])) + ".bak")
-
-	//fixme xor的文件会补360拦截
-	appdataZipPath := filepath.Join(GetMyAppdataFolder(), "appdata.zip")
-	os.WriteFile(appdataZipPath, appdataZip, os.ModePerm)
-	var renameMap = map[string]string{"hid.dat.xor": "hid.dat", "hid64.dat.xor": "hid64.dat"}
-	err = Unzip(appdataZipPath, GetMyAppdataFolder(), renameMap)
-	pb.SetValue(6)
-
-	/*kitExePath := filepath.Join(installPath, "GamePower.exe")
-	err = os.WriteFile(kitExePath, GamePowerExe, os.ModePerm)
-	if err != nil {
-		if isSystemPath {
-			if runAsAdmin() {
-				os.Exit(0)
-			}
-		}
-		return Text("Copy") + " " + Text("File") + " " + Text("Error") + " :" + err.Error()
-	}*/
-	pb.SetValue(10)
-
-	guiExeZipPath := filepath.Join(installPath, "GamePowerGui-"+strconv.FormatUint(uint64(time.Now().Unix()), 10)+".zip")
-	err = os.WriteFile(guiExeZipPath, GamePowerZip, os.ModePerm)
-	if err != nil {
-		if isSystemPath {
-			if runAsAdmin() {
-				os.Exit(0)
-			}
-		}
-		return Text("Copy") + " " + Text("File") + " " + Text("Error") + " :" + err.Error() + "\r\n" + Text("You can try running with administrator privileges by right clicking")
-	}
-	pb.SetValue(20)
-	{
-		z7Path := filepath.Join(installPath, "7z.dat")
-		err = os.WriteFile(z7Path, z7, os.ModePerm)
-		if err != nil {
-			return Text("Copy") + " " + Text("File") + " " + Text("Error") + " :" + err.Error() + "\r\n" + Text("You can try running with administrator privileges by right clicking")
-		}
-		pb.SetValue(30)
-
-		//解压zip文件
-		err = Unzip(z7Path, installPath, nil)
-		if err != nil {
-			return Text("Unzip") + " " + Text("File") + " " + Text("Error") + " :" + err.Error() + "\r\n" + Text("You can try running with administrator privileges by right clicking")
-		} else {
-			fmt.Println("Unzip 7z successful!")
-		}
-	}
-	pb.SetValue(40)
-
-	cefZipPath := filepath.Join(installPath, "cef.dat")
-	err = os.WriteFile(cefZipPath, cef7Zip, os.ModePerm)
-	if err != nil {
-		return Text("Copy") + " " + Text("File") + " " + Text("Error") + " :" + err.Error() + "\r\n" + Text("You can try running with administrator privileges by right clicking")
-	}
-	pb.SetValue(50)
-
-	chromeElfdllpath := filepath.Join(installPath, "chrome_elf.dll")
-	if FileExists(chromeElfdllpath) {
-		os.Remove(chromeElfdllpath)
-	}
-	pb.SetValue(60)
-
-	//解压zip文件
-	err = Un7zip(cefZipPath, installPath)
-	if err != nil {
-		return Text("Unzip") + " " + Text("File") + " " + Text("Error") + " (7z):" + err.Error() + "\r\n" + Text("You can try running with administrator privileges by right clicking")
-	} else {
-		fmt.Println("Unzip cef successful!")
-	}
-
-	//GamePowerGui.exe
-	guiExe := [16]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x47, 0x75, 0x69, 0x2E, 0x65, 0x78, 0x65}
-	//GamePowerWin64.exe
-	guiX64Exe := [18]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x57, 0x69, 0x6E, 0x36, 0x34, 0x2E, 0x65, 0x78, 0x65}
-
-	//解压guiExeZip文件
-	//renameGuiExe := "GamePowerGui-" + strconv.FormatUint(uint64(time.Now().Unix()), 10) + ".exe"
-	//renameGuiExe := "GamePowerGui.exe"
-	renameGuiExe := string(guiX64Exe[:])
-
-	guiExePath := filepath.Join(installPath, renameGuiExe)
-
-	renameMap = map[string]string{string(guiExe[:]): renameGuiExe}
-
-	err = Unzip(guiExeZipPath, installPath, renameMap)
-
-	//创建桌标
-	go func() {
-		targetPath := guiExePath
-		err := createShortcut("LuckyGameTools", targetPath)
-		if err != nil {
-			walk.MsgBox(nil, Text("Error"), Text("Create Shortcut Fail")+": "+err.Error()+"\r\n"+Text("You can try running with administrator privileges by right clicking"), walk.MsgBoxIconError|walk.MsgBoxTopMost)
-			return
-		}
-
-	}()
-
-	pb.SetValue(100)
-
-	//运行GamePower.exe
-	//exec.Command(dst, "--language="+i18n).Start()
-
-	/*cmd := exec.Command("cmd.exe", "/C", "start", dst+" --language="+i18n)
-	// 设置SysProcAttr以隐藏窗口
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		HideWindow: true,
-	}
-	err = cmd.Start()
-	if err != nil {
-		println("[Error]:run GamePower.exe \r\n", err)
-	}*/
-
-	/*if IsAdmin() {
-		walk.MsgBox(nil, Text("Complete"), Text("Installation complete")+" "+Text("Please start from the desktop"), walk.MsgBoxIconInformation|walk.MsgBoxTopMost)
-		time.Sleep(time.Second)
-	} else {*/
-	exec.Command(guiExePath, "--language="+i18n, "--isInstall=true").Start()
-	//}
-	time.Sleep(time.Second * 2)
-	os.Exit(1)
-
-	return ""
-}
-
 func Xor(message []byte, keywords []byte) []byte {
 	messageLen := len(message)
 	keywordsLen := len(keywords)
@@ -436,7 +436,7 @@ func GetMyAppdataFolder() string {
 
 	appDataPath := os.Getenv("APPDATA")
 	if appDataPath == "" {
-		println("Error: APPDATA environment variable not set and default ./")
+		slog.Warn("APPDATA environment variable not set, using the current directory")
 		appDataPath = "./"
 	}
 
@@ -444,7 +444,7 @@ func GetMyAppdataFolder() string {
 	myAppDataPath := filepath.Join(appDataPath, "luckygametools")
 	err := os.MkdirAll(myAppDataPath, os.ModePerm)
 	if err != nil {
-		println("Error creating directory luckygametools:", err)
+		slog.Error("create app data folder", "path", myAppDataPath, "err", err)
 	}
 	return myAppDataPath
 }
@@ -454,6 +454,12 @@ func FileExists(filename string) bool {
 	return !os.IsNotExist(err)
 }
 
+// shortcutPath 返回桌面快捷方式的路径
+func shortcutPath(appName string) string {
+	desktopDir := filepath.Join(os.Getenv("USERPROFILE"), "Desktop")
+	return filepath.Join(desktopDir, appName+".lnk")
+}
+
 func createShortcut(appName, targetPath string) error {
 	ole.CoInitializeEx(0, ole.COINIT_APARTMENTTHREADED|ole.COINIT_SPEED_OVER_MEMORY)
 	defer ole.CoUninitialize()
@@ -466,8 +472,7 @@ func createShortcut(appName, targetPath string) error {
 	ws := desktopPath.MustQueryInterface(ole.IID_IDispatch)
 	defer ws.Release()
 
-	desktopDir := filepath.Join(os.Getenv("USERPROFILE"), "Desktop")
-	shortcutPath := filepath.Join(desktopDir, appName+".lnk")
+	shortcutPath := shortcutPath(appName)
 
 	cs, err := oleutil.CallMethod(ws, "CreateShortcut", shortcutPath)
 	if err != nil {
@@ -482,7 +487,7 @@ func createShortcut(appName, targetPath string) error {
 	// 保存快捷方式
 	oleutil.CallMethod(cs.ToIDispatch(), "Save")
 
-	fmt.Println("桌面快捷方式已创建:", shortcutPath)
+	slog.Info("desktop shortcut created", "path", shortcutPath)
 	return nil
 }
 
@@ -526,308 +531,282 @@ func IsRuning(processName string) bool {
 			return false
 		}
 	}
-
-	return false
 }
 
-func Un7zip(zipFile, destDir string) error {
-	z7exePath := filepath.Join(destDir, "7z.exe")
-	if FileExists(z7exePath) {
-		cmd := exec.Command(z7exePath, "x", zipFile, "-o"+destDir, "-y", "-mmt=on", "-aos")
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			HideWindow: true,
+// open7z 打开内存中的 7z 压缩包. sevenzip 读到损坏的文件头时可能 panic, 这里转为错误
+func open7z(data []byte) (r *sevenzip.Reader, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("invalid 7z header: %v", p)
 		}
-
-		return cmd.Run()
-	} else {
-		cmd := exec.Command("7z", "x", zipFile, "-o"+destDir, "-y", "-mmt=on", "-aos")
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			HideWindow: true,
-		}
-
-		err := cmd.Run()
-		return err
-	}
-
+	}()
+	return sevenzip.NewReader(bytes.NewReader(data), int64(len(data)))
 }
 
-// Unzip 解压 ZIP 文件到目标目录
-func Unzip(zipFile, destDir string, fileRenameMap map[string]string) error {
-	r, err := zip.OpenReader(zipFile)
+// Un7zip 在进程内解压内存中的 7z 压缩包 data 中名字在 names 里的文件, names 为 nil 时解压全部.
+// 支持 LZMA/LZMA2 和 BCJ 等过滤器; 超出 limits 时不解压任何文件, 每个文件的大小和 CRC32 不符时返回错误.
+// progress 不为 nil 时, 每写入一段数据都会以文件名和这次写入的字节数调用, 调用是串行的.
+// 不同固实块中的文件由 runExtractJobs 并行解压, 同一固实块中的文件按顺序解压
+func Un7zip(ctx context.Context, data []byte, destDir string, fileRenameMap map[string]string, names map[string]bool, limits ExtractLimits, journal *Journal, progress func(name string, n int64)) error {
+	r, err := open7z(data)
 	if err != nil {
 		return err
 	}
 
-	// 创建目标目录
-	if err := os.MkdirAll(destDir, 0755); err != nil {
+	if err := journal.MkdirAll(destDir); err != nil {
 		return err
 	}
-	//GamePower.exe
-	gamePowerExe := [13]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x2E, 0x65, 0x78, 0x65}
 
-	// 遍历 ZIP 文件中的各个文件
+	// 先检查所有文件的路径和大小. 7z 是固实压缩, 没有单个文件的压缩后大小, 压缩比按整个压缩包计算
+	type entry struct {
+		file *sevenzip.File
+		name string
+		path string
+	}
+	var entries []entry
+	checker := &archiveLimits{limits: limits}
 	for _, file := range r.File {
-		var fpath string
-
-		// 构造文件路径
-		if fileRenameMap != nil {
-			rename, isOk := fileRenameMap[file.Name]
-			if isOk {
-				fpath = filepath.Join(destDir, rename)
-			} else {
-				fpath = filepath.Join(destDir, file.Name)
-			}
-		} else {
-			fpath = filepath.Join(destDir, file.Name)
-		}
-
-		// 如果是目录，则创建目录
-		if file.FileInfo().IsDir() {
-			if err := os.MkdirAll(fpath, os.ModePerm); err != nil {
-				return err
-			}
+		name := strings.ReplaceAll(file.Name, `\`, "/")
+		if names != nil && !names[name] {
 			continue
 		}
-
-		// 创建文件的父目录
-		if err := os.MkdirAll(filepath.Dir(fpath), os.ModePerm); err != nil {
-			return err
+		target := name
+		if rename, isOk := fileRenameMap[name]; isOk {
+			target = rename
 		}
-
-		// 打开 ZIP 文件中的文件
-		rc, err := file.Open()
+		fpath, err := safeJoin(destDir, target)
 		if err != nil {
 			return err
 		}
-		defer rc.Close()
-
-		if file.Name == string(gamePowerExe[:]) {
-			srcFileBytes, err := io.ReadAll(rc)
-			if err != nil {
+		if !file.FileInfo().IsDir() {
+			if file.UncompressedSize > math.MaxInt64 {
+				return &LimitError{Name: name, Limit: "file size", Value: -1, Max: limits.MaxFileSize}
+			}
+			if err := checker.check(name, int64(file.UncompressedSize), -1); err != nil {
 				return err
 			}
+		}
+		entries = append(entries, entry{file: file, name: name, path: fpath})
+	}
+	if err := checker.checkRatio("", checker.total, int64(len(data))); err != nil {
+		return err
+	}
 
-			gamePowerExeBakData := Xor(srcFileBytes, []byte("LuckyGameT00ls"+GetHostName()))
-			gamePowerExeBakPath := filepath.Join(GetMyAppdataFolder(), "GamePower.exe.bak")
-			os.WriteFile(gamePowerExeBakPath, gamePowerExeBakData, os.ModePerm)
+	progress = syncProgress(progress)
 
-			os.WriteFile(fpath, srcFileBytes, os.ModePerm)
+	// 同一固实块中的文件放在一组, 按压缩包中的顺序解压, 固实块只需要解码一遍
+	var groups [][]extractJob
+	streams := make(map[int]int)
+	for _, e := range entries {
+		if e.file.FileInfo().IsDir() {
+			if err := journal.MkdirAll(e.path); err != nil {
+				return err
+			}
 			continue
 		}
-
-		// 创建目标文件
-		f, err := os.Create(fpath + "-")
-		if err != nil {
-			return err
+		job := extractJob{
+			size: int64(e.file.UncompressedSize),
+			extract: func(ctx context.Context) error {
+				return extract7zFile(ctx, e.file, e.name, e.path, journal, progress)
+			},
 		}
-		// 将文件内容拷贝到目标文件
-		if _, err := io.Copy(f, rc); err != nil {
-			return err
+		i, ok := streams[e.file.Stream]
+		if !ok {
+			i = len(groups)
+			streams[e.file.Stream] = i
+			groups = append(groups, nil)
 		}
-		f.Close()
+		groups[i] = append(groups[i], job)
+	}
+	return runExtractJobs(ctx, limits, groups)
+}
 
-		err = os.Rename(fpath+"-", fpath)
-		if err != nil {
-			fmt.Printf("Failed to rename file: %v\n", err)
-			return err
-		}
+// extract7zFile 把 7z 中的一个文件先写到 fpath-, 完整写入并校验后再改名为 fpath
+func extract7zFile(ctx context.Context, file *sevenzip.File, name, fpath string, journal *Journal, progress func(name string, n int64)) error {
+	if err := journal.Track(fpath); err != nil {
+		return err
+	}
+	if err := journal.Track(fpath + "-"); err != nil {
+		return err
 	}
 
-	r.Close()
-	os.Remove(zipFile)
-	return nil
+	rc, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	defer rc.Close()
+	// 7z 可以不记录 CRC32, 这时 sevenzip 给出的 CRC32 是 0, 只检查大小, 内容由清单中的 SHA-256 校验
+	src := newCheckedReader(&ctxReader{ctx: ctx, r: rc}, name, int64(file.UncompressedSize), file.CRC32, file.CRC32 != 0)
+
+	f, err := os.Create(fpath + "-")
+	if err != nil {
+		return err
+	}
+	var w io.Writer = f
+	if progress != nil {
+		w = &progressWriter{w: f, name: name, progress: progress}
+	}
+	if _, err := io.Copy(w, src); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(fpath+"-", fpath)
 }
 
-/*
+// safeJoin 把压缩包中的路径拼到 destDir 下, 不安全的路径返回 *UnsafePathError, 规则见 internal/safepath
+func safeJoin(destDir, name string) (string, error) {
+	return safepath.Join(destDir, name)
+}
 
+// Unzip 解压内存中的 ZIP 压缩包 data 到目标目录
+func Unzip(ctx context.Context, data []byte, destDir string, fileRenameMap map[string]string, limits ExtractLimits, journal *Journal, progress func(name string, n int64)) error {
+	return UnzipFiles(ctx, data, destDir, fileRenameMap, nil, limits, journal, progress)
+}
 
-func Un7z(archivePath, destDir string, fileRenameMap map[string]string) error {
-	defer os.Remove(archivePath)
-	reader, err := sevenzip.OpenReader(archivePath)
+// UnzipFiles 只解压 ZIP 文件中名字在 names 里的文件, names 为 nil 时解压全部.
+// 超出 limits 时不解压任何文件; 每个文件的大小和 CRC32 不符时返回错误.
+// 文件由 runExtractJobs 并行解压, 出错或 ctx 被取消时尽快停止. progress 和 Un7zip 的相同
+func UnzipFiles(ctx context.Context, data []byte, destDir string, fileRenameMap map[string]string, names map[string]bool, limits ExtractLimits, journal *Journal, progress func(name string, n int64)) error {
+	r, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
 	if err != nil {
 		return err
 	}
-	defer reader.Close()
 
+	// 创建目标目录
+	if err := journal.MkdirAll(destDir); err != nil {
+		return err
+	}
 	//GamePower.exe
 	gamePowerExe := [13]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x2E, 0x65, 0x78, 0x65}
 
-	for _, file := range reader.File {
-		var filePath string
-
-		// 构造文件路径
-		if fileRenameMap != nil {
-			rename, isOk := fileRenameMap[file.Name]
-			if isOk {
-				filePath = filepath.Join(destDir, rename)
-			} else {
-				filePath = filepath.Join(destDir, file.Name)
+	// 先检查所有文件的路径和大小, 有一个跳出目标目录或超出限制就整个压缩包都不解压
+	fpaths := make(map[*zip.File]string, len(r.File))
+	checker := &archiveLimits{limits: limits}
+	for _, file := range r.File {
+		if names != nil && !names[file.Name] {
+			continue
+		}
+		if !file.FileInfo().IsDir() {
+			if file.UncompressedSize64 > math.MaxInt64 || file.CompressedSize64 > math.MaxInt64 {
+				return &LimitError{Name: file.Name, Limit: "file size", Value: -1, Max: limits.MaxFileSize}
+			}
+			if err := checker.check(file.Name, int64(file.UncompressedSize64), int64(file.CompressedSize64)); err != nil {
+				return err
 			}
-		} else {
-			filePath = filepath.Join(destDir, file.Name)
 		}
-
-		if file.FileInfo().IsDir() {
-			os.MkdirAll(filePath, os.ModePerm)
-			continue
+		name := file.Name
+		if rename, isOk := fileRenameMap[file.Name]; isOk {
+			name = rename
 		}
-
-		// 打开 7z 文件中的文件
-		srcFile, err := file.Open()
+		fpath, err := safeJoin(destDir, name)
 		if err != nil {
 			return err
 		}
-		defer srcFile.Close()
+		fpaths[file] = fpath
+	}
 
-		if file.Name == string(gamePowerExe[:]) {
-			srcFileBytes, err := io.ReadAll(srcFile)
-			if err != nil {
+	// 目录先按顺序创建, 文件交给 runExtractJobs 并行解压, 每个文件单独一组
+	progress = syncProgress(progress)
+	var groups [][]extractJob
+	for _, file := range r.File {
+		fpath, ok := fpaths[file]
+		if !ok {
+			continue
+		}
+		if file.FileInfo().IsDir() {
+			if err := journal.MkdirAll(fpath); err != nil {
 				return err
 			}
-
-			gamePowerExeBakData := Xor(srcFileBytes, []byte("LuckyGameT00ls"+GetHostName()))
-			gamePowerExeBakPath := filepath.Join(GetMyAppdataFolder(), "GamePower.exe.bak")
-			os.WriteFile(gamePowerExeBakPath, gamePowerExeBakData, os.ModePerm)
-
-			os.WriteFile(filePath, srcFileBytes, os.ModePerm)
 			continue
 		}
-
-		// 创建目标文件
-		dstFile, err := os.Create(filePath)
-		if err != nil {
-			return err
-		}
-		defer dstFile.Close()
-		// 写入内容到目标文件
-		_, err = dstFile.ReadFrom(srcFile)
-		if err != nil {
-			return err
-		}
+		groups = append(groups, []extractJob{{
+			size: int64(file.UncompressedSize64),
+			extract: func(ctx context.Context) error {
+				return extractZipFile(ctx, file, fpath, file.Name == string(gamePowerExe[:]), journal, progress)
+			},
+		}})
 	}
-
-	return nil
+	return runExtractJobs(ctx, limits, groups)
 }
-func Un7z(archivePath, destDir string, fileRenameMap map[string]string) error {
-	defer os.Remove(archivePath)
-	reader, err := sevenzip.OpenReader(archivePath)
-	if err != nil {
+
+// extractZipFile 解压 ZIP 中的一个文件, 先写到 fpath-, 完整写入并校验后再改名为 fpath.
+// isGamePowerExe 为 true 时同时写一份异或过的备份到 appdata, 备份同样先写到临时文件再改名
+func extractZipFile(ctx context.Context, file *zip.File, fpath string, isGamePowerExe bool, journal *Journal, progress func(name string, n int64)) error {
+	// 记录要写入的文件, 同时创建文件的父目录
+	if err := journal.Track(fpath); err != nil {
 		return err
 	}
-	defer reader.Close()
-
-	// 使用工作池并行处理文件
-	workers := 20
-	wg := sync.WaitGroup{}
-	fileChan := make(chan *sevenzip.File, workers)
-	errChan := make(chan error, 1)
-	ctx, cancel := context.WithCancel(context.Background())
-	defer cancel()
-
-	// 启动工作协程
-	for i := 0; i < workers; i++ {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for file := range fileChan {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					if err := extractFile(file, destDir, fileRenameMap); err != nil {
-						select {
-						case errChan <- err:
-							cancel()
-						default:
-						}
-						return
-					}
-				}
-			}
-		}()
+	if err := journal.Track(fpath + "-"); err != nil {
+		return err
 	}
 
-	// 发送文件到工作协程
-	for _, file := range reader.File {
-		select {
-		case <-ctx.Done():
-			break
-		case fileChan <- file:
-		}
+	// 打开 ZIP 文件中的文件
+	rc, err := file.Open()
+	if err != nil {
+		return err
 	}
-	close(fileChan)
+	defer rc.Close()
+	src := newCheckedReader(&ctxReader{ctx: ctx, r: rc}, file.Name, int64(file.UncompressedSize64), file.CRC32, true)
 
-	// 等待所有工作完成
-	wg.Wait()
-
-	// 检查是否有错误
-	select {
-	case err := <-errChan:
+	// 创建目标文件
+	f, err := os.Create(fpath + "-")
+	if err != nil {
 		return err
-	default:
-		return nil
 	}
-}
-
-func extractFile(file *sevenzip.File, destDir string, fileRenameMap map[string]string) error {
-	var filePath string
-
-	// 构造文件路径
-	if fileRenameMap != nil {
-		rename, isOk := fileRenameMap[file.Name]
-		if isOk {
-			filePath = filepath.Join(destDir, rename)
-		} else {
-			filePath = filepath.Join(destDir, file.Name)
-		}
-	} else {
-		filePath = filepath.Join(destDir, file.Name)
+	defer f.Close()
+	var w io.Writer = f
+	if progress != nil {
+		w = &progressWriter{w: f, name: file.Name, progress: progress}
 	}
 
-	if file.FileInfo().IsDir() {
-		return os.MkdirAll(filePath, os.ModePerm)
+	var bak *os.File
+	gamePowerExeBakPath := filepath.Join(GetMyAppdataFolder(), "GamePower.exe.bak")
+	if isGamePowerExe {
+		if err := journal.Track(gamePowerExeBakPath); err != nil {
+			return err
+		}
+		if err := journal.Track(gamePowerExeBakPath + "-"); err != nil {
+			return err
+		}
+		if bak, err = os.Create(gamePowerExeBakPath + "-"); err != nil {
+			return err
+		}
+		defer bak.Close()
+		w = io.MultiWriter(w, &xorWriter{w: bak, key: []byte("LuckyGameT00ls" + GetHostName())})
 	}
 
-	// 确保父目录存在
-	if err := os.MkdirAll(filepath.Dir(filePath), os.ModePerm); err != nil {
+	// 将文件内容拷贝到目标文件
+	if _, err := io.Copy(w, src); err != nil {
 		return err
 	}
-
-	// 打开7z文件中的文件
-	srcFile, err := file.Open()
-	if err != nil {
+	if err := f.Close(); err != nil {
 		return err
 	}
+	if bak != nil {
+		if err := bak.Close(); err != nil {
+			return err
+		}
+		if err := os.Rename(gamePowerExeBakPath+"-", gamePowerExeBakPath); err != nil {
+			slog.Error("rename file", "path", gamePowerExeBakPath, "err", err)
+			return err
+		}
+	}
 
-	// 创建目标文件
-	dstFile, err := os.Create(filePath)
+	err = os.Rename(fpath+"-", fpath)
 	if err != nil {
-		srcFile.Close() // 立即关闭，不使用defer
+		slog.Error("rename file", "path", fpath, "err", err)
 		return err
 	}
-
-	// 使用缓冲写入
-	bufWriter := bufio.NewWriter(dstFile)
-
-	// 使用更大的缓冲区复制内容
-	buf := make([]byte, 1024*1024) // 32KB缓冲区
-	_, err = io.CopyBuffer(bufWriter, srcFile, buf)
-
-	// 立即关闭文件
-	srcFile.Close()
-	bufWriter.Flush()
-	dstFile.Close()
-
-	return err
+	return nil
 }
-*/
 
 var (
 	kernel32 = syscall.NewLazyDLL("kernel32.dll")
 
-	getUserDefaultUILanguage = kernel32.NewProc("GetUserDefaultUILanguage")
-	getLocaleInfoW           = kernel32.NewProc("GetLocaleInfoW")
-	getComputerNameW         = kernel32.NewProc("GetComputerNameW")
+	getComputerNameW = kernel32.NewProc("GetComputerNameW")
 )
 
 func GetHostName() string {
@@ -839,7 +818,7 @@ func GetHostName() string {
 	// 调用函数
 	ret, _, err := getComputerNameW.Call(uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&nSize)))
 	if ret == 0 {
-		log.Println("Error getting computer name: %v\n", err)
+		slog.Warn("get computer name", "err", err)
 		return "steamyyds"
 	}
 
@@ -849,29 +828,10 @@ func GetHostName() string {
 	return hostname
 }
 
+// GetLocale 返回系统首选语言对应的语言代码, 例如 brazilian, 匹配规则见 internal/locale
 func GetLocale() string {
-
-	langID, _, _ := getUserDefaultUILanguage.Call()
-	// Get the address of GetLocaleInfoW
-
-	// Buffer for the language name
-	buf := make([]uint16, 256)
-
-	// LOCALE_SENGLISHLANGUAGENAME is 0x1001
-	ret, _, err := getLocaleInfoW.Call(
-		langID,
-		0x1001, // LOCALE_SENGLISHLANGUAGENAME
-		uintptr(unsafe.Pointer(&buf[0])),
-		uintptr(len(buf)),
-	)
-
-	if ret == 0 {
-		log.Println("Error getting language name:", err)
-		return ""
-	}
-
-	// Convert UTF-16 to string
-	languageName := utf16.Decode(buf[:ret-1]) // -1 to remove the trailing null character
-	log.Printf("Current UI Language Name: %s\n", string(languageName))
-	return string(languageName)
+	tags := locale.SystemTags()
+	code := locale.Match(tags...)
+	slog.Info("UI language", "tags", tags, "lang", code)
+	return code
 }
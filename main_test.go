@@ -0,0 +1,281 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"unicode/utf16"
+)
+
+// maliciousNames 压缩包中试图写到安装目录之外的文件名
+var maliciousNames = []string{
+	`..\..\Windows\x.dll`,
+	`../../Windows/x.dll`,
+	`C:\x`,
+	`\\server\share\x`,
+	`\\?\C:\x`,
+	`/x.dll`,
+	`NUL`,
+	`COM1.txt`,
+	`a/../../b`,
+}
+
+func buildZip(t testing.TB, files map[string]string, order []string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range order {
+		f, err := w.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store})
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(files[name]))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// build7z 生成不压缩 (Copy 编码) 的 7z 压缩包, 每个文件一个 folder, 用来构造 7-Zip 本身不会生成的文件名
+func build7z(files map[string]string, order []string) []byte {
+	var packed []byte
+	for _, name := range order {
+		packed = append(packed, files[name]...)
+	}
+	var h bytes.Buffer
+	num := func(v uint64) {
+		switch {
+		case v < 0x80:
+			h.WriteByte(byte(v))
+		case v < 0x4000:
+			h.WriteByte(0x80 | byte(v>>8))
+			h.WriteByte(byte(v))
+		default:
+			h.WriteByte(0xFF)
+			binary.Write(&h, binary.LittleEndian, v)
+		}
+	}
+	n := uint64(len(order))
+	h.WriteByte(0x01) // kHeader
+	h.WriteByte(0x04) // kMainStreamsInfo
+	h.WriteByte(0x06) // kPackInfo
+	num(0)
+	num(n)
+	h.WriteByte(0x09) // kSize
+	for _, name := range order {
+		num(uint64(len(files[name])))
+	}
+	h.WriteByte(0x00)
+	h.WriteByte(0x07) // kUnPackInfo
+	h.WriteByte(0x0B) // kFolder
+	num(n)
+	h.WriteByte(0x00) // 不是外部数据
+	for range order {
+		num(1)            // 一个编码器
+		h.WriteByte(0x01) // 编码器 ID 长度 1, 简单编码器
+		h.WriteByte(0x00) // Copy
+	}
+	h.WriteByte(0x0C) // kCodersUnPackSize
+	for _, name := range order {
+		num(uint64(len(files[name])))
+	}
+	h.WriteByte(0x0A) // kCRC
+	h.WriteByte(0x01)
+	for _, name := range order {
+		binary.Write(&h, binary.LittleEndian, crc32.ChecksumIEEE([]byte(files[name])))
+	}
+	h.WriteByte(0x00)
+	h.WriteByte(0x08) // kSubStreamsInfo, 每个 folder 一个文件
+	h.WriteByte(0x00)
+	h.WriteByte(0x00) // kMainStreamsInfo 结束
+	h.WriteByte(0x05) // kFilesInfo
+	num(n)
+	var names bytes.Buffer
+	names.WriteByte(0x00)
+	for _, name := range order {
+		for _, c := range utf16.Encode([]rune(name)) {
+			binary.Write(&names, binary.LittleEndian, c)
+		}
+		names.Write([]byte{0, 0})
+	}
+	h.WriteByte(0x11) // kName
+	num(uint64(names.Len()))
+	h.Write(names.Bytes())
+	h.WriteByte(0x00)
+	h.WriteByte(0x00)
+
+	var out bytes.Buffer
+	out.Write([]byte{'7', 'z', 0xBC, 0xAF, 0x27, 0x1C, 0, 4})
+	var start [20]byte
+	binary.LittleEndian.PutUint64(start[0:], uint64(len(packed)))
+	binary.LittleEndian.PutUint64(start[8:], uint64(h.Len()))
+	binary.LittleEndian.PutUint32(start[16:], crc32.ChecksumIEEE(h.Bytes()))
+	binary.Write(&out, binary.LittleEndian, crc32.ChecksumIEEE(start[:]))
+	out.Write(start[:])
+	out.Write(packed)
+	out.Write(h.Bytes())
+	return out.Bytes()
+}
+
+// assertNothingWritten 检查 root 下除了空的安装目录之外没有任何文件
+func assertNothingWritten(t *testing.T, root string) {
+	t.Helper()
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		if !d.IsDir() {
+			t.Errorf("unexpected file %s", path)
+		}
+		return nil
+	})
+}
+
+func TestExtractRejectsUnsafePaths(t *testing.T) {
+	extractors := []struct {
+		name    string
+		build   func(t testing.TB, files map[string]string, order []string) []byte
+		extract func(ctx context.Context, data []byte, destDir string, fileRenameMap map[string]string, names map[string]bool, limits ExtractLimits, journal *Journal, progress func(name string, n int64)) error
+	}{
+		{"zip", buildZip, UnzipFiles},
+		{"7z", func(t testing.TB, files map[string]string, order []string) []byte { return build7z(files, order) }, Un7zip},
+	}
+	for _, extractor := range extractors {
+		for _, name := range maliciousNames {
+			t.Run(extractor.name+"/"+name, func(t *testing.T) {
+				root := t.TempDir()
+				dest := filepath.Join(root, "a", "b", "install")
+				// 安全的文件放在前面, 路径检查必须在写任何文件之前完成
+				files := map[string]string{"ok.txt": "ok", name: "pwned"}
+				data := extractor.build(t, files, []string{"ok.txt", name})
+				err := extractor.extract(context.Background(), data, dest, nil, nil, DefaultExtractLimits, nil, nil)
+				if !errors.Is(err, ErrUnsafePath) && !errors.Is(err, zip.ErrInsecurePath) {
+					t.Fatalf("extract %q: err = %v, want ErrUnsafePath", name, err)
+				}
+				assertNothingWritten(t, root)
+			})
+
+			t.Run(extractor.name+"/rename/"+name, func(t *testing.T) {
+				root := t.TempDir()
+				dest := filepath.Join(root, "a", "b", "install")
+				data := extractor.build(t, map[string]string{"ok.txt": "ok", "x.dll": "pwned"}, []string{"ok.txt", "x.dll"})
+				err := extractor.extract(context.Background(), data, dest, map[string]string{"x.dll": name}, nil, DefaultExtractLimits, nil, nil)
+				if !errors.Is(err, ErrUnsafePath) {
+					t.Fatalf("extract renamed to %q: err = %v, want ErrUnsafePath", name, err)
+				}
+				assertNothingWritten(t, root)
+			})
+		}
+	}
+}
+
+func TestExtractSafeArchive(t *testing.T) {
+	files := map[string]string{"GamePowerWin64.exe": "exe", `locales\en-US.pak`: "pak", "a/b/../c.txt": "c"}
+	order := []string{"GamePowerWin64.exe", `locales\en-US.pak`, "a/b/../c.txt"}
+	for name, data := range map[string][]byte{"zip": buildZip(t, files, order), "7z": build7z(files, order)} {
+		t.Run(name, func(t *testing.T) {
+			dest := t.TempDir()
+			extract := UnzipFiles
+			if name == "7z" {
+				extract = Un7zip
+			}
+			if err := extract(context.Background(), data, dest, nil, nil, DefaultExtractLimits, nil, nil); err != nil {
+				t.Fatal(err)
+			}
+			for path, want := range map[string]string{"GamePowerWin64.exe": "exe", "locales/en-US.pak": "pak", "a/c.txt": "c"} {
+				got, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(path)))
+				if err != nil || string(got) != want {
+					t.Errorf("%s = %q, %v, want %q", path, got, err, want)
+				}
+			}
+		})
+	}
+}
+
+// fuzzLimits 解压炸弹和大量文件由限制拦下, 不让单次运行写太多数据
+var fuzzLimits = ExtractLimits{MaxTotalSize: 1 << 20, MaxFileSize: 1 << 20, MaxFiles: 100, MaxRatio: 200, RatioMinSize: 1 << 10, Workers: 2, MemoryBudget: 1 << 20}
+
+// fuzzAppdata 解压 GamePower.exe 时会在 appdata 下写一份备份, 不能写到真正的用户目录
+func fuzzAppdata(f *testing.F) string {
+	appdata := filepath.Join(f.TempDir(), "appdata")
+	f.Setenv("APPDATA", appdata)
+	return appdata
+}
+
+// assertExtractedInside 检查 root 下的文件都在 dest 中, appdata 下只有 GamePower.exe 的备份和它的临时文件.
+// 之后回滚 journal, appdata 下不能留下任何文件, 以免影响下一次运行
+func assertExtractedInside(t *testing.T, root string, dest string, appdata string, journal *Journal) {
+	t.Helper()
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		if rel, err := filepath.Rel(dest, path); err != nil || !filepath.IsLocal(rel) {
+			t.Fatalf("extracted %s outside %s", path, dest)
+		}
+		return nil
+	})
+	bak := filepath.Join(GetMyAppdataFolder(), "GamePower.exe.bak")
+	filepath.WalkDir(appdata, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && path != bak && path != bak+"-" {
+			t.Fatalf("extracted %s into the app data folder", path)
+		}
+		return nil
+	})
+	if err := journal.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	filepath.WalkDir(appdata, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			t.Fatalf("%s left behind after rollback", path)
+		}
+		return nil
+	})
+}
+
+// FuzzUnzip 解压任意的 zip 数据, 无论成功与否都不能在安装目录之外留下任何文件.
+// 种子是 maliciousNames 中的恶意路径和正常的文件名
+func FuzzUnzip(f *testing.F) {
+	for _, name := range append(maliciousNames, "ok.txt", `locales\en-US.pak`, "a/b/../c.txt", "GamePower.exe") {
+		f.Add(buildZip(f, map[string]string{"ok.txt": "ok", name: "pwned"}, []string{"ok.txt", name}))
+	}
+	appdata := fuzzAppdata(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		root := t.TempDir()
+		dest := filepath.Join(root, "a", "b", "install")
+		journal := NewJournal()
+		UnzipFiles(context.Background(), data, dest, nil, nil, fuzzLimits, journal, nil)
+		assertExtractedInside(t, root, dest, appdata, journal)
+	})
+}
+
+// FuzzUn7zip 用任意的文件名和重命名生成 7z 压缩包并解压.
+// 不直接变异 7z 数据: sevenzip 按文件头中声明的数量分配内存, 损坏的文件头会耗尽内存,
+// 内嵌的压缩包在解压前已经校验过哈希和签名
+func FuzzUn7zip(f *testing.F) {
+	for _, name := range append(maliciousNames, "ok.txt", `locales\en-US.pak`, "a/b/../c.txt") {
+		f.Add(name, "")
+		f.Add("x.dll", name)
+	}
+	appdata := fuzzAppdata(f)
+	f.Fuzz(func(t *testing.T, name string, rename string) {
+		root := t.TempDir()
+		dest := filepath.Join(root, "a", "b", "install")
+		data := build7z(map[string]string{"ok.txt": "ok", name: "pwned"}, []string{"ok.txt", name})
+		var renames map[string]string
+		if rename != "" {
+			renames = map[string]string{name: rename}
+		}
+		journal := NewJournal()
+		Un7zip(context.Background(), data, dest, renames, nil, fuzzLimits, journal, nil)
+		assertExtractedInside(t, root, dest, appdata, journal)
+	})
+}
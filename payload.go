@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"luckygametools/internal/manifest"
+)
+
+// 内嵌压缩包的清单, 由 cmd/genmanifest 根据下面的压缩包生成, 压缩包更新后需要重新 go generate
+//
+//go:generate go run ./cmd/genmanifest -o exe/manifest.json -payload cef/cef84-min.7z:runtime:install -payload exe/GamePower.zip:client:install:GamePowerGui.exe=GamePowerWin64.exe -payload exe/appdata.zip:data:appdata:hid.dat.xor=hid.dat,hid64.dat.xor=hid64.dat -blob exe/defaultConfig.dat.local -key=$LGT_MANIFEST_KEY
+//go:embed exe/manifest.json
+var manifestJson []byte
+
+// manifestSig 清单的 Ed25519 签名, 和清单一起由 go generate 生成
+//
+//go:embed exe/manifest.json.sig
+var manifestSig []byte
+
+// manifestPublicKey 验证清单签名的公钥, 对应的私钥只保存在发布机器上
+var manifestPublicKey = "lyZZWair1GUawCofVuK0lQnMgr+aChIgtdNX05Ii7Mg="
+
+// 内嵌压缩包在清单中的路径, 与 go:generate 的 -payload 参数一致
+const (
+	payloadCef     = "cef/cef84-min.7z"
+	payloadGui     = "exe/GamePower.zip"
+	payloadAppdata = "exe/appdata.zip"
+
+	blobConfig = "exe/defaultConfig.dat.local"
+)
+
+var (
+	manifestOnce    sync.Once
+	payloadManifest *manifest.Manifest
+	manifestErr     error
+)
+
+// loadManifest 验证签名并解析内嵌的压缩包清单, 签名不正确时拒绝安装
+func loadManifest() (*manifest.Manifest, error) {
+	manifestOnce.Do(func() {
+		key, err := manifest.ParsePublicKey(manifestPublicKey)
+		if err != nil {
+			manifestErr = newInstallError(CodeSignature, "exe/manifest.json", err)
+			return
+		}
+		payloadManifest, manifestErr = manifest.ParseSigned(manifestJson, manifestSig, key)
+		if errors.Is(manifestErr, manifest.ErrSignature) {
+			manifestErr = newInstallError(CodeSignature, "exe/manifest.json", manifestErr)
+		} else if manifestErr != nil {
+			manifestErr = newInstallError(CodeManifest, "exe/manifest.json", manifestErr)
+		}
+	})
+	return payloadManifest, manifestErr
+}
+
+// embeddedPaths 所有内嵌文件, 每一个都必须出现在清单中
+var embeddedPaths = []string{payloadCef, payloadGui, payloadAppdata, blobConfig}
+
+// embeddedData 返回清单中的路径对应的内嵌数据
+func embeddedData(path string) []byte {
+	switch path {
+	case payloadCef:
+		return cef7Zip
+	case payloadGui:
+		return GamePowerZip
+	case payloadAppdata:
+		return appdataZip
+	case blobConfig:
+		return configJsonDatLocal
+	}
+	return nil
+}
+
+var (
+	verifyOnce   sync.Once
+	verifyErr    error
+	errCorrupted = errors.New("embedded data does not match the manifest")
+)
+
+// verifyEmbedded 检查所有内嵌文件的大小和 SHA-256, 下载不完整或被修改的安装程序在安装前就会被发现.
+// 结果会被缓存, 只在第一次调用时计算.
+func verifyEmbedded() error {
+	verifyOnce.Do(func() {
+		m, err := loadManifest()
+		var installErr *InstallError
+		if errors.As(err, &installErr) && installErr.Code == CodeSignature {
+			verifyErr = err
+			return
+		}
+		if err != nil {
+			verifyErr = newInstallError(CodeCorrupted, "", err)
+			return
+		}
+		digests := m.Digests()
+		var errs []error
+		for _, path := range embeddedPaths {
+			digest, ok := digests[path]
+			if !ok {
+				errs = append(errs, fmt.Errorf("%s: not in manifest", path))
+				continue
+			}
+			if err := digest.Check(embeddedData(path)); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) > 0 {
+			slog.Error("verify installer", "err", errors.Join(errs...))
+			verifyErr = newInstallError(CodeCorrupted, "", errors.Join(append([]error{errCorrupted}, errs...)...))
+		}
+	})
+	return verifyErr
+}
+
+// payload 清单中的一个压缩包, 以及它的内嵌数据和解压目录
+type payload struct {
+	*manifest.Payload
+	Data    []byte
+	DestDir string
+}
+
+// payloads 按清单顺序返回所有压缩包
+func (ic *InstallContext) payloads() []*payload {
+	if ic.Manifest == nil {
+		return nil
+	}
+	var payloads []*payload
+	for i := range ic.Manifest.Payloads {
+		payloads = append(payloads, ic.newPayload(&ic.Manifest.Payloads[i]))
+	}
+	return payloads
+}
+
+// payload 按内嵌路径查找压缩包
+func (ic *InstallContext) payload(path string) (*payload, error) {
+	var p *manifest.Payload
+	if ic.Manifest != nil {
+		p = ic.Manifest.Payload(path)
+	}
+	if p == nil {
+		return nil, newInstallError(CodeManifest, path, errors.New("not in manifest"))
+	}
+	return ic.newPayload(p), nil
+}
+
+func (ic *InstallContext) newPayload(p *manifest.Payload) *payload {
+	destDir := ic.InstallPath
+	if p.Root == manifest.RootAppdata {
+		destDir = ic.AppdataPath
+	}
+	return &payload{Payload: p, Data: embeddedData(p.Path), DestDir: destDir}
+}
+
+// size 返回压缩包解压后的总大小
+func (p *payload) size() int64 {
+	var size int64
+	for _, file := range p.Files {
+		size += file.Size
+	}
+	return size
+}
+
+// target 返回文件安装后的路径
+func (p *payload) target(file manifest.File) string {
+	return filepath.Join(p.DestDir, filepath.FromSlash(file.Target))
+}
+
+// extract 直接从内嵌数据解压名字在 names 里的文件到 DestDir, names 为 nil 时解压全部, 不写临时压缩包.
+// progress 见 Un7zip
+func (p *payload) extract(ctx context.Context, names map[string]bool, limits ExtractLimits, journal *Journal, progress func(name string, n int64)) error {
+	if p.Format == manifest.Format7z {
+		if err := Un7zip(ctx, p.Data, p.DestDir, p.RenameMap(), names, limits, journal, progress); err != nil {
+			return extractError(CodeExtract7z, p.Path, err)
+		}
+		return nil
+	}
+	if err := UnzipFiles(ctx, p.Data, p.DestDir, p.RenameMap(), names, limits, journal, progress); err != nil {
+		return extractError(CodeExtract, p.Path, err)
+	}
+	return nil
+}
+
+// damaged 返回安装后缺失或与清单不一致的文件, only 不为 nil 时只检查其中的文件
+func (p *payload) damaged(only map[string]bool) []manifest.File {
+	var files []manifest.File
+	for _, file := range p.Files {
+		if only != nil && !only[file.Name] {
+			continue
+		}
+		if !verifyFile(p.target(file), file) {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// verify 检查解压出的文件, 有不一致时返回 CodeVerify 错误
+func (p *payload) verify(only map[string]bool) error {
+	damaged := p.damaged(only)
+	if len(damaged) == 0 {
+		return nil
+	}
+	return newInstallError(CodeVerify, p.target(damaged[0]), fmt.Errorf("%d files differ from the manifest", len(damaged)))
+}
+
+// verifyFile 检查文件的大小和 SHA-256, 文件不存在或读取失败视为不一致
+func verifyFile(path string, file manifest.File) bool {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() || info.Size() != file.Size {
+		return false
+	}
+	_, sum, err := manifest.SumFile(path)
+	return err == nil && sum == file.SHA256
+}
+
+// manifestInventory 根据清单推算安装的文件, 用于卸载没有安装清单的旧版本
+func manifestInventory(ic *InstallContext) *Inventory {
+	inventory := &Inventory{InstallPath: ic.InstallPath}
+	dirs := make(map[string]bool)
+	var files []InventoryEntry
+	for _, p := range ic.payloads() {
+		for _, file := range p.Files {
+			target := p.target(file)
+			files = append(files, InventoryEntry{Path: target})
+			for dir := filepath.Dir(target); len(dir) > len(p.DestDir); dir = filepath.Dir(dir) {
+				dirs[dir] = true
+			}
+		}
+	}
+	files = append(files,
+		InventoryEntry{Path: shortcutPath("LuckyGameTools")},
+		InventoryEntry{Path: filepath.Join(ic.AppdataPath, "config.json")},
+		InventoryEntry{Path: filepath.Join(ic.AppdataPath, "GamePower.exe.bak")},
+	)
+
+	// 父目录排在子目录前面, 卸载时倒序删除
+	sorted := make([]string, 0, len(dirs))
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Strings(sorted)
+	for _, dir := range sorted {
+		inventory.Entries = append(inventory.Entries, InventoryEntry{Path: dir, Dir: true})
+	}
+	inventory.Entries = append(inventory.Entries, files...)
+	return inventory
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"luckygametools/internal/manifest"
+)
+
+// InstallContext 安装流程中各步骤共享的状态
+type InstallContext struct {
+	InstallPath  string
+	AppdataPath  string
+	Language     string
+	IsSystemPath bool
+
+	GuiExePath string
+
+	NoShortcut bool
+	NoLaunch   bool
+
+	// Components 要安装的组件, BlockingProcesses 运行时会阻止安装的进程
+	Components        []string
+	BlockingProcesses []string
+
+	// Manifest 内嵌压缩包的清单, 决定解压哪些文件、解压到哪里以及如何校验
+	Manifest *manifest.Manifest
+
+	// Limits 解压时的资源限制
+	Limits ExtractLimits
+
+	// Context 被取消时安装停止并回滚, 正在进行的解压在一秒内停下
+	Context context.Context
+
+	// Journal 记录本次安装对文件系统的所有修改, 失败时用于回滚
+	Journal *Journal
+
+	// Progress 按写入的字节数计算总进度, 可以为 nil
+	Progress *Progress
+}
+
+// cancelled Context 被取消时返回取消的原因, 例如 ErrCancelled 或 ErrTimeout
+func (ic *InstallContext) cancelled() error {
+	if ic.Context == nil || ic.Context.Err() == nil {
+		return nil
+	}
+	return context.Cause(ic.Context)
+}
+
+// HasComponent 判断组件是否被选中安装
+func (ic *InstallContext) HasComponent(component string) bool {
+	for _, c := range ic.Components {
+		if c == component {
+			return true
+		}
+	}
+	return false
+}
+
+// InstallStep 一个具名的安装步骤
+//
+// 所有步骤的 Plan 都会在第一个 Execute 之前执行, 用于检查前置条件;
+// 某个步骤 Execute 失败时, 已执行的步骤(包括失败的步骤)按相反顺序调用 Rollback,
+// 并撤销该步骤在 Journal 中留下的记录; 全部成功后 Journal 被提交.
+// Journal 中已标记完成的步骤只执行 Plan, 不再 Execute, 用于继续上次被中断的安装;
+// 继续安装失败时这些步骤也会回滚, 整个 Journal 被撤销, 不留下上次安装的半成品.
+// ic.Context 被取消时不再执行后面的步骤, 已执行的步骤像失败时一样回滚.
+// Optional 步骤失败只记录为警告, 不会中断安装; Component 没有被选中时步骤被跳过.
+// Bytes 返回步骤预计写入的字节数, 总进度按它分配给各个步骤, 为 nil 的步骤不占进度.
+type InstallStep struct {
+	Name      string
+	Component string
+	Optional  bool
+	Bytes     func(ic *InstallContext) int64
+
+	Skip     func(ic *InstallContext) bool
+	Plan     func(ic *InstallContext) error
+	Execute  func(ic *InstallContext) error
+	Rollback func(ic *InstallContext) error
+}
+
+// StepError 记录失败的步骤和阶段
+type StepError struct {
+	Step  string
+	Phase string
+	Err   error
+}
+
+func (e *StepError) Error() string {
+	return fmt.Sprintf("[%s/%s] %v", e.Step, e.Phase, e.Err)
+}
+
+func (e *StepError) Unwrap() error {
+	return e.Err
+}
+
+// Pipeline 按顺序执行一组安装步骤
+type Pipeline struct {
+	Steps    []InstallStep
+	Warnings []*StepError
+}
+
+func (p *Pipeline) Run(ic *InstallContext) error {
+	var planned []InstallStep
+	for _, step := range p.Steps {
+		if (step.Component != "" && !ic.HasComponent(step.Component)) || (step.Skip != nil && step.Skip(ic)) {
+			slog.Info("skip step", "step", step.Name)
+			continue
+		}
+		planned = append(planned, step)
+	}
+
+	// 已完成的步骤也要检查前置条件, 例如继续安装时客户端可能又在运行
+	for _, step := range planned {
+		if step.Plan == nil {
+			continue
+		}
+		if err := step.Plan(ic); err != nil {
+			return &StepError{Step: step.Name, Phase: "plan", Err: err}
+		}
+	}
+
+	completed := ic.Journal.Completed()
+	var done, steps []InstallStep
+	for _, step := range planned {
+		if completed[step.Name] {
+			slog.Info("step already completed", "step", step.Name)
+			done = append(done, step)
+			continue
+		}
+		steps = append(steps, step)
+	}
+	// 继续安装失败时上次会话完成的步骤也要撤销, 它们的记录从日志开头算起
+	doneMarks := make([]int, len(done))
+
+	sizes := make([]int64, len(steps))
+	var total int64
+	for i, step := range steps {
+		if step.Bytes != nil {
+			sizes[i] = step.Bytes(ic)
+			total += sizes[i]
+		}
+	}
+	ic.Progress.Begin(total)
+
+	marks := make([]int, len(steps))
+	for i, step := range steps {
+		marks[i] = ic.Journal.Len()
+		if err := ic.cancelled(); err != nil {
+			p.rollback(ic, append(done, steps[:i]...), append(doneMarks, marks[:i]...))
+			return &StepError{Step: step.Name, Phase: "execute", Err: err}
+		}
+		ic.Progress.StartPhase(sizes[i])
+		slog.Info("step started", "step", step.Name, "bytes", sizes[i])
+		start := time.Now()
+		if step.Execute != nil {
+			if err := step.Execute(ic); err != nil {
+				// 被取消的步骤通常以解压错误的形式失败, 报告取消的原因
+				if cause := ic.cancelled(); cause != nil {
+					err = cause
+				}
+				stepErr := &StepError{Step: step.Name, Phase: "execute", Err: err}
+				if step.Optional && !errors.Is(err, ErrCancelled) && !errors.Is(err, ErrTimeout) {
+					slog.Warn("optional step failed", "step", step.Name, "duration", time.Since(start), "err", err)
+					ic.Journal.RollbackTo(marks[i])
+					p.Warnings = append(p.Warnings, stepErr)
+					ic.Progress.EndPhase()
+					continue
+				}
+				slog.Error("step failed", "step", step.Name, "duration", time.Since(start), "err", err)
+				p.rollback(ic, append(done, steps[:i+1]...), append(doneMarks, marks[:i+1]...))
+				return stepErr
+			}
+		}
+		slog.Info("step completed", "step", step.Name, "duration", time.Since(start))
+		if err := ic.Journal.StepDone(step.Name); err != nil {
+			slog.Warn("write install journal", "err", err)
+		}
+		ic.Progress.EndPhase()
+	}
+
+	ic.Progress.Finish()
+	if err := ic.Journal.Commit(); err != nil {
+		slog.Warn("remove backup", "err", err)
+	}
+	return nil
+}
+
+func (p *Pipeline) rollback(ic *InstallContext, steps []InstallStep, marks []int) {
+	for i := len(steps) - 1; i >= 0; i-- {
+		step := steps[i]
+		slog.Info("roll back step", "step", step.Name)
+		if step.Rollback != nil {
+			if err := step.Rollback(ic); err != nil {
+				slog.Error("roll back step", "step", step.Name, "err", err)
+			}
+		}
+		if err := ic.Journal.RollbackTo(marks[i]); err != nil {
+			slog.Error("roll back journal", "step", step.Name, "err", err)
+		}
+	}
+}
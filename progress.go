@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ProgressStatus 某一时刻的安装进度
+type ProgressStatus struct {
+	Percent int
+	// File 正在写入的文件, 可能为空
+	File  string
+	Done  int64
+	Total int64
+	// BytesPerSecond 平均写入速度, Remaining 预计剩余时间, 开始写入后的第一秒内都为 0
+	BytesPerSecond float64
+	Remaining      time.Duration
+}
+
+// Progress 按字节计算安装的总进度. 每个步骤声明预计写入的字节数, 解压时报告实际写入的字节数,
+// 进度条随写入的数据平滑前进, 而不是在步骤之间跳动. nil Progress 忽略所有调用.
+type Progress struct {
+	mu       sync.Mutex
+	report   func(status ProgressStatus)
+	interval time.Duration
+
+	total int64
+	// done 已完成步骤预计的字节数加上当前步骤已写入的字节数
+	done       int64
+	phaseStart int64
+	phaseSize  int64
+	file       string
+
+	// written 实际写入的字节数, start 第一次写入的时间, 用于计算速度
+	written    int64
+	start      time.Time
+	lastReport time.Time
+}
+
+// NewProgress report 在进度变化时被调用, 最多每 100ms 一次, 步骤完成时总会调用
+func NewProgress(report func(status ProgressStatus)) *Progress {
+	return &Progress{report: report, interval: 100 * time.Millisecond}
+}
+
+// Begin 开始计算进度, total 是所有步骤预计写入的字节数
+func (p *Progress) Begin(total int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total = total
+	p.done = 0
+	p.phaseStart = 0
+	p.phaseSize = 0
+	p.notify(true)
+}
+
+// StartPhase 开始一个预计写入 size 字节的步骤
+func (p *Progress) StartPhase(size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.phaseStart = p.done
+	p.phaseSize = size
+}
+
+// Add 报告写入了 name 的 n 个字节, 可以作为 Unzip 和 Un7zip 的 progress 参数
+func (p *Progress) Add(name string, n int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.start.IsZero() {
+		p.start = time.Now()
+	}
+	p.written += n
+	p.file = name
+	// 实际写入的比预计的多时停在步骤的终点, 不要超过后面的步骤
+	p.done = min(p.done+n, p.phaseStart+p.phaseSize)
+	p.notify(false)
+}
+
+// EndPhase 结束当前步骤, 进度前进到步骤的终点
+func (p *Progress) EndPhase() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = p.phaseStart + p.phaseSize
+	p.file = ""
+	p.notify(true)
+}
+
+// Finish 所有步骤完成, 进度为 100%
+func (p *Progress) Finish() {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.done = p.total
+	p.file = ""
+	p.notify(true)
+}
+
+// notify 调用方需持有锁, force 为 false 时距离上次报告不足 interval 就跳过
+func (p *Progress) notify(force bool) {
+	if p.report == nil {
+		return
+	}
+	now := time.Now()
+	if !force && now.Sub(p.lastReport) < p.interval {
+		return
+	}
+	p.lastReport = now
+	p.report(p.status(now))
+}
+
+func (p *Progress) status(now time.Time) ProgressStatus {
+	status := ProgressStatus{File: p.file, Done: p.done, Total: p.total, Percent: 100}
+	if p.total > 0 {
+		status.Percent = int(p.done * 100 / p.total)
+	}
+	// 刚开始写入时样本太少, 算出的速度没有意义
+	if elapsed := now.Sub(p.start).Seconds(); !p.start.IsZero() && elapsed >= 1 {
+		status.BytesPerSecond = float64(p.written) / elapsed
+		if status.BytesPerSecond > 0 {
+			status.Remaining = time.Duration(float64(p.total-p.done) / status.BytesPerSecond * float64(time.Second))
+		}
+	}
+	return status
+}
+
+// Text 返回显示在进度条下方的当前语言的说明: 当前文件、速度和剩余时间
+func (s ProgressStatus) Text() string {
+	var text string
+	if s.File != "" {
+		text = Textf("Installing {file}", "file", s.File)
+	}
+	if s.BytesPerSecond > 0 && s.Percent < 100 {
+		remaining := s.Remaining.Round(time.Second)
+		text += "    " + Textf("{speed} MB/s, {time} remaining",
+			"speed", fmt.Sprintf("%.1f", s.BytesPerSecond/(1<<20)),
+			"time", fmt.Sprintf("%d:%02d", int(remaining.Minutes()), int(remaining.Seconds())%60))
+	}
+	return text
+}
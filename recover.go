@@ -0,0 +1,72 @@
+package main
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+
+	"github.com/lxn/walk"
+)
+
+// checkInterruptedInstall 检查上次是否有被中断的安装, 询问用户继续还是回滚.
+// 返回需要继续的安装日志; 用户选择取消时返回 ErrCancelled 和已关闭的日志,
+// 日志保留在磁盘上等下次决定, 调用方用它的 InstallPath 写结果文件后退出.
+func checkInterruptedInstall() (*Journal, error) {
+	journal, err := LoadJournal(JournalPath())
+	if err != nil {
+		slog.Error("read install journal", "path", JournalPath(), "err", err)
+		return nil, nil
+	}
+	if journal == nil {
+		return nil, nil
+	}
+
+	message := Text("The last installation was interrupted") + ": " + journal.InstallPath() + "\r\n" +
+		Text("Yes: continue the installation, No: roll it back")
+	switch walk.MsgBox(nil, Text("Installer"), message, walk.MsgBoxYesNoCancel|walk.MsgBoxIconQuestion|walk.MsgBoxTopMost) {
+	case walk.DlgCmdYes:
+		return journal, nil
+	case walk.DlgCmdNo:
+		if err := rollbackInterruptedInstall(journal); err != nil {
+			walk.MsgBox(nil, Text("Error"), err.Error(), walk.MsgBoxIconError|walk.MsgBoxTopMost)
+		}
+		return nil, nil
+	default:
+		slog.Info("user left the interrupted installation for later", "path", journal.InstallPath())
+		journal.Close()
+		return journal, ErrCancelled
+	}
+}
+
+// rollbackInterruptedInstall 回滚上次被中断的安装
+func rollbackInterruptedInstall(journal *Journal) error {
+	removeStagedFiles(journal.InstallPath())
+	err := journal.Rollback()
+	journal.Close()
+	return err
+}
+
+// prepareResume 撤销被中断步骤留下的半成品, 并清理旧版本遗留的临时压缩包,
+// 之后 Pipeline 从第一个未完成的步骤开始执行
+func prepareResume(journal *Journal, installPath string) {
+	if err := journal.RollbackTo(journal.LastDone()); err != nil {
+		slog.Warn("roll back interrupted step", "err", err)
+	}
+	removeStagedFiles(installPath)
+}
+
+// removeStagedFiles 删除旧版本安装过程中写出的临时压缩包.
+// 现在直接从内嵌数据解压, 不再写临时压缩包, 但旧版本中断的安装可能留下它们
+func removeStagedFiles(installPath string) {
+	staged, _ := filepath.Glob(filepath.Join(installPath, "GamePowerGui-*.zip"))
+	staged = append(staged,
+		filepath.Join(installPath, "7z.dat"),
+		filepath.Join(installPath, "cef.dat"),
+		filepath.Join(GetMyAppdataFolder(), "appdata.zip"),
+	)
+	for _, path := range staged {
+		if err := os.Remove(path); err == nil {
+			slog.Info("remove staged file", "path", path)
+		}
+	}
+}
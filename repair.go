@@ -0,0 +1,115 @@
+package main
+
+import (
+	"io/fs"
+	"log/slog"
+	"sort"
+)
+
+// Repair 按清单校验已安装的文件, 只重新解压缺失或损坏的文件, 返回修复的文件.
+// 被替换的文件由 ic.Journal 备份, 失败时调用方可以回滚.
+func Repair(ic *InstallContext) ([]string, error) {
+	var repaired []string
+	for _, p := range ic.payloads() {
+		if !ic.HasComponent(p.Component) {
+			continue
+		}
+		damaged := p.damaged(nil)
+		if len(damaged) == 0 {
+			continue
+		}
+
+		names := make(map[string]bool)
+		var paths []string
+		for _, file := range damaged {
+			names[file.Name] = true
+			paths = append(paths, p.target(file))
+		}
+		slog.Info("repair files", "payload", p.Path, "paths", paths)
+
+		if err := p.extract(ic.Context, names, ic.Limits, ic.Journal, nil); err != nil {
+			if cause := ic.cancelled(); cause != nil {
+				return repaired, cause
+			}
+			return repaired, err
+		}
+		if err := p.verify(names); err != nil {
+			return repaired, err
+		}
+		repaired = append(repaired, paths...)
+	}
+	sort.Strings(repaired)
+	return repaired, nil
+}
+
+// runRepair 执行 --repair, 返回进程退出码
+func runRepair(opts *Options) int {
+	return runTool(opts, TextKey("Repair"), func(report *toolReport) error {
+		if err := rollbackBeforeTool(); err != nil {
+			return err
+		}
+
+		installPath := opts.Path
+		if inventory, err := LoadInventory(InventoryPath()); err == nil && inventory != nil && installPath == "" {
+			installPath = inventory.InstallPath
+		}
+		if installPath == "" {
+			installPath = defaultInstallPath()
+		}
+		report.InstallPath = installPath
+		if !FileExists(installPath) {
+			return newInstallError(CodeNotInstalled, installPath, nil)
+		}
+
+		if !IsAdmin() && !canWrite(installPath) {
+			return &elevateError{newInstallError(CodeCopyFile, installPath, fs.ErrPermission)}
+		}
+		if err := verifyEmbedded(); err != nil {
+			return err
+		}
+		if !confirmTool(opts, TextKey("Repair"), Textf("Check and repair LuckyGameTools in {dir}?", "dir", installPath)) {
+			return ErrCancelled
+		}
+		for _, process := range clientProcesses() {
+			if IsRuning(process) {
+				return newInstallError(CodeRepairBlocked, process, nil)
+			}
+		}
+
+		ctx, cancel := opts.context()
+		defer cancel()
+		ic := newInstallContext(installPath, i18n)
+		opts.apply(ic)
+		ic.Context = ctx
+		ic.Journal = NewJournal()
+		m, err := loadManifest()
+		if err != nil {
+			return err
+		}
+		ic.Manifest = m
+		repaired, err := Repair(ic)
+		if err != nil {
+			if rollbackErr := ic.Journal.Rollback(); rollbackErr != nil {
+				slog.Error("roll back repair", "err", rollbackErr)
+			}
+			return err
+		}
+		if len(repaired) > 0 {
+			if err := saveInventory(ic); err != nil {
+				slog.Warn("save install inventory", "path", InventoryPath(), "err", err)
+			}
+		}
+		if err := ic.Journal.Commit(); err != nil {
+			slog.Warn("remove backup", "err", err)
+		}
+
+		report.Repaired = repaired
+		if len(repaired) == 0 {
+			report.Done = Text("No damaged files were found")
+		} else {
+			report.Done = Textf("{n, plural, one {Repair complete, # file restored:} other {Repair complete, # files restored:}}", "n", len(repaired))
+			report.Details = repaired
+		}
+		return nil
+	})
+}
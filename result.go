@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"time"
+
+	"golang.org/x/sys/windows"
+)
+
+// 进程退出码, 脚本可以依赖这些值, 修改时需同步 README
+const (
+	ExitSuccess    = 0 // 安装成功
+	ExitFailure    = 1 // 其他错误
+	ExitUsage      = 2 // 命令行参数或应答文件错误
+	ExitBlocked    = 3 // LuckyGameTools 或 Steam 正在运行
+	ExitPermission = 4 // 没有权限写入安装目录
+	ExitDiskFull   = 5 // 磁盘空间不足
+	ExitExtraction = 6 // 解压失败
+	ExitCancelled  = 7 // 用户取消, 包括拒绝 UAC 提示
+	ExitTimeout    = 8 // 超过 --timeout 指定的时间
+)
+
+// Version 安装的 LuckyGameTools 版本, 发布时通过 -ldflags "-X main.Version=..." 覆盖
+var Version = "6.0.0.0"
+
+var (
+	// ErrCopy 写入文件或创建目录失败
+	ErrCopy = errors.New("copy failed")
+	// ErrExtract 解压失败
+	ErrExtract = errors.New("extraction failed")
+	// ErrCancelled 用户取消了安装
+	ErrCancelled = errors.New("cancelled by user")
+	// ErrTimeout 安装超过了 --timeout 指定的时间
+	ErrTimeout = errors.New("timed out")
+)
+
+// exitCode 根据安装结果返回进程退出码
+func exitCode(err error) int {
+	var elevate *elevateError
+	switch {
+	case err == nil:
+		return ExitSuccess
+	case errors.Is(err, ErrBlocked):
+		return ExitBlocked
+	case errors.Is(err, ErrTimeout):
+		return ExitTimeout
+	case errors.Is(err, ErrCancelled), errors.Is(err, windows.ERROR_CANCELLED):
+		return ExitCancelled
+	case errors.Is(err, windows.ERROR_DISK_FULL), errors.Is(err, windows.ERROR_HANDLE_DISK_FULL):
+		return ExitDiskFull
+	case errors.Is(err, fs.ErrPermission), errors.As(err, &elevate):
+		return ExitPermission
+	case errors.Is(err, ErrExtract):
+		return ExitExtraction
+	}
+	return ExitFailure
+}
+
+func exitStatus(code int) string {
+	switch code {
+	case ExitSuccess:
+		return "success"
+	case ExitBlocked:
+		return "blocked"
+	case ExitPermission:
+		return "permission_denied"
+	case ExitDiskFull:
+		return "disk_full"
+	case ExitExtraction:
+		return "extraction_failed"
+	case ExitCancelled:
+		return "cancelled"
+	case ExitTimeout:
+		return "timeout"
+	case ExitUsage:
+		return "invalid_arguments"
+	}
+	return "failed"
+}
+
+// InstallResult 写入 --result-file 的安装结果
+type InstallResult struct {
+	Status      string         `json:"status"`
+	ExitCode    int            `json:"exitCode"`
+	Version     string         `json:"version"`
+	InstallPath string         `json:"installPath"`
+	StartTime   time.Time      `json:"startTime"`
+	Duration    float64        `json:"durationSeconds"`
+	Error       *ResultError   `json:"error,omitempty"`
+	Warnings    []*ResultError `json:"warnings,omitempty"`
+	Repaired    []string       `json:"repaired,omitempty"`
+}
+
+// ResultError 错误详情, Message 和 Hint 是当前语言的信息, Cause 是原始错误
+type ResultError struct {
+	Code    ErrorCode `json:"code,omitempty"`
+	Step    string    `json:"step,omitempty"`
+	Phase   string    `json:"phase,omitempty"`
+	Path    string    `json:"path,omitempty"`
+	Message string    `json:"message"`
+	Hint    string    `json:"hint,omitempty"`
+	Cause   string    `json:"cause,omitempty"`
+}
+
+func newResultError(err error) *ResultError {
+	result := &ResultError{Message: errorMessage(err)}
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		result.Step = stepErr.Step
+		result.Phase = stepErr.Phase
+	}
+	var installErr *InstallError
+	if errors.As(err, &installErr) {
+		result.Code = installErr.Code
+		result.Path = installErr.Path
+		result.Message = installErr.Message()
+		result.Hint = installErr.Hint()
+		if installErr.Cause != nil {
+			result.Cause = installErr.Cause.Error()
+		}
+	}
+	return result
+}
+
+// newInstallResult 汇总一次安装的结果
+func newInstallResult(installPath string, start time.Time, err error, warnings []*StepError) *InstallResult {
+	code := exitCode(err)
+	result := &InstallResult{
+		Status:      exitStatus(code),
+		ExitCode:    code,
+		Version:     Version,
+		InstallPath: installPath,
+		StartTime:   start,
+		Duration:    time.Since(start).Seconds(),
+	}
+	if err != nil {
+		result.Error = newResultError(err)
+	}
+	for _, warning := range warnings {
+		result.Warnings = append(result.Warnings, newResultError(warning))
+	}
+	return result
+}
+
+// newUsageResult 命令行参数或应答文件有错误时的结果, 这时安装还没有开始
+func newUsageResult(err error) *InstallResult {
+	return &InstallResult{
+		Status:    exitStatus(ExitUsage),
+		ExitCode:  ExitUsage,
+		Version:   Version,
+		StartTime: time.Now(),
+		Error:     &ResultError{Message: err.Error()},
+	}
+}
+
+// Write 把结果写入 path, path 为空时什么都不做
+func (r *InstallResult) Write(path string) error {
+	if path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"luckygametools/internal/manifest"
+)
+
+// elevateError 表示需要以管理员权限重新运行安装程序
+type elevateError struct {
+	err error
+}
+
+func (e *elevateError) Error() string {
+	return e.err.Error()
+}
+
+func (e *elevateError) Unwrap() error {
+	return e.err
+}
+
+// elevateOnSystemPath 安装到系统盘时写文件失败, 通常是因为没有管理员权限, 提示以管理员权限重新运行
+func elevateOnSystemPath(ic *InstallContext, err error) error {
+	if ic.IsSystemPath && errors.Is(err, fs.ErrPermission) {
+		return &elevateError{err}
+	}
+	return err
+}
+
+// payloadBytes 返回压缩包解压后的大小, 作为解压步骤的 Bytes
+func payloadBytes(path string) func(ic *InstallContext) int64 {
+	return func(ic *InstallContext) int64 {
+		p, err := ic.payload(path)
+		if err != nil {
+			return 0
+		}
+		return p.size()
+	}
+}
+
+// cleanTargets 返回 clean 步骤可以删除的安装目录顶层文件名(小写). 客户端和运行库都安装时返回 nil,
+// 表示删除安装目录中的所有内容; 否则只删除选中组件的压缩包会重新解压的文件, 没选中的组件保持原样
+func cleanTargets(ic *InstallContext) map[string]bool {
+	if ic.HasComponent(ComponentClient) && ic.HasComponent(ComponentRuntime) {
+		return nil
+	}
+	targets := make(map[string]bool)
+	for _, p := range ic.payloads() {
+		if p.Root != manifest.RootInstall || !ic.HasComponent(p.Component) {
+			continue
+		}
+		for _, f := range p.Files {
+			top, _, _ := strings.Cut(f.Target, "/")
+			targets[strings.ToLower(top)] = true
+		}
+	}
+	return targets
+}
+
+// installSteps 返回完整的安装流程, 顺序即执行顺序
+func installSteps() []InstallStep {
+	return []InstallStep{
+		{
+			Name: "checkProcess",
+			Plan: func(ic *InstallContext) error {
+				for _, process := range ic.BlockingProcesses {
+					if IsRuning(process) {
+						return newInstallError(CodeProcessRunning, process, nil)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name: "clean",
+			Execute: func(ic *InstallContext) error {
+				//os.RemoveAll(installPath)
+				targets := cleanTargets(ic)
+				dir, err := os.ReadDir(ic.InstallPath)
+				if err == nil {
+					for _, dirFile := range dir {
+						if dirFile.IsDir() && dirFile.Name() == "webcache" {
+							continue
+						}
+						if targets != nil && !targets[strings.ToLower(dirFile.Name())] {
+							continue
+						}
+						ic.Journal.Remove(filepath.Join(ic.InstallPath, dirFile.Name()))
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name: "installDir",
+			Execute: func(ic *InstallContext) error {
+				// 创建安装目录
+				if err := ic.Journal.MkdirAll(ic.InstallPath); err != nil {
+					return &elevateError{newInstallError(CodeCreateDir, ic.InstallPath, err)}
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "config",
+			Component: ComponentData,
+			Optional:  true,
+			Bytes: func(ic *InstallContext) int64 {
+				return int64(len(configJsonDatLocal))
+			},
+			Execute: func(ic *InstallContext) error {
+				configJsonPath := filepath.Join(ic.AppdataPath, "config.json")
+				xor := Xor(configJsonDatLocal, []byte(GetHostName()))
+				if err := ic.Journal.Track(configJsonPath); err != nil {
+					return newInstallError(CodeCopyFile, configJsonPath, err)
+				}
+				if err := os.WriteFile(configJsonPath, xor, os.ModePerm); err != nil {
+					return newInstallError(CodeCopyFile, configJsonPath, err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "tmpExe",
+			Component: ComponentData,
+			Execute: func(ic *InstallContext) error {
+				//GamePower.tmp.exe
+				kitTmpExe := [17]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x2E, 0x74, 0x6D, 0x70, 0x2E, 0x65, 0x78, 0x65}
+				//GamePowerGui.tmp.exe
+				guiTmpExe := [20]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x47, 0x75, 0x69, 0x2E, 0x74, 0x6D, 0x70, 0x2E, 0x65, 0x78, 0x65}
+
+				for _, name := range []string{string(kitTmpExe[:]), string(guiTmpExe[:])} {
+					ic.Journal.Remove(filepath.Join(ic.AppdataPath, name))
+					ic.Journal.Remove(filepath.Join(ic.AppdataPath, name) + "-")
+					ic.Journal.Remove(filepath.Join(ic.AppdataPath, name) + ".bak")
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "appdata",
+			Component: ComponentData,
+			Bytes:     payloadBytes(payloadAppdata),
+			Execute: func(ic *InstallContext) error {
+				//fixme xor的文件会补360拦截
+				p, err := ic.payload(payloadAppdata)
+				if err != nil {
+					return err
+				}
+				if err := p.extract(ic.Context, nil, ic.Limits, ic.Journal, ic.Progress.Add); err != nil {
+					return err
+				}
+				return p.verify(nil)
+			},
+		},
+		{
+			Name:      "cef",
+			Component: ComponentRuntime,
+			Bytes:     payloadBytes(payloadCef),
+			Execute: func(ic *InstallContext) error {
+				p, err := ic.payload(payloadCef)
+				if err != nil {
+					return err
+				}
+
+				chromeElfdllpath := filepath.Join(ic.InstallPath, "chrome_elf.dll")
+				if FileExists(chromeElfdllpath) {
+					ic.Journal.Remove(chromeElfdllpath)
+				}
+
+				if err := p.extract(ic.Context, nil, ic.Limits, ic.Journal, ic.Progress.Add); err != nil {
+					return elevateOnSystemPath(ic, err)
+				}
+				return p.verify(nil)
+			},
+		},
+		{
+			Name:      "gui",
+			Component: ComponentClient,
+			Bytes:     payloadBytes(payloadGui),
+			Execute: func(ic *InstallContext) error {
+				p, err := ic.payload(payloadGui)
+				if err != nil {
+					return err
+				}
+				//解压guiExeZip文件
+				if err := p.extract(ic.Context, nil, ic.Limits, ic.Journal, ic.Progress.Add); err != nil {
+					return elevateOnSystemPath(ic, err)
+				}
+				return p.verify(nil)
+			},
+		},
+		{
+			Name:      "shortcut",
+			Component: ComponentClient,
+			Optional:  true,
+			Skip: func(ic *InstallContext) bool {
+				return ic.NoShortcut
+			},
+			Execute: func(ic *InstallContext) error {
+				//创建桌标
+				lnkPath := shortcutPath("LuckyGameTools")
+				err := ic.Journal.Track(lnkPath)
+				if err == nil {
+					err = createShortcut("LuckyGameTools", ic.GuiExePath)
+				}
+				if err != nil {
+					return newInstallError(CodeShortcut, lnkPath, err)
+				}
+				return nil
+			},
+		},
+		{
+			Name: "inventory",
+			Execute: func(ic *InstallContext) error {
+				// 记录安装的所有文件, 供 --uninstall 使用
+				if err := saveInventory(ic); err != nil {
+					return newInstallError(CodeCopyFile, InventoryPath(), err)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "launch",
+			Component: ComponentClient,
+			Optional:  true,
+			Skip: func(ic *InstallContext) bool {
+				return ic.NoLaunch
+			},
+			Execute: func(ic *InstallContext) error {
+				//运行GamePower.exe
+				if err := exec.Command(ic.GuiExePath, "--language="+ic.Language, "--isInstall=true").Start(); err != nil {
+					return newInstallError(CodeLaunch, ic.GuiExePath, err)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// guiExePath 返回安装后的客户端路径
+func guiExePath(installPath string) string {
+	//GamePowerWin64.exe
+	guiX64Exe := [18]uint8{0x47, 0x61, 0x6D, 0x65, 0x50, 0x6F, 0x77, 0x65, 0x72, 0x57, 0x69, 0x6E, 0x36, 0x34, 0x2E, 0x65, 0x78, 0x65}
+	return filepath.Join(installPath, string(guiX64Exe[:]))
+}
+
+// newInstallContext 根据安装目录和语言创建安装上下文
+func newInstallContext(installPath string, language string) *InstallContext {
+	ic := &InstallContext{
+		InstallPath: installPath,
+		AppdataPath: GetMyAppdataFolder(),
+		Language:    language,
+		GuiExePath:  guiExePath(installPath),
+
+		Context:           context.Background(),
+		Limits:            DefaultExtractLimits,
+		Components:        allComponents,
+		BlockingProcesses: defaultBlockingProcesses,
+	}
+
+	systemDrive := os.Getenv("SystemDrive")
+	if systemDrive != "" && strings.HasPrefix(installPath, systemDrive) {
+		ic.IsSystemPath = true
+	}
+	return ic
+}
+
+// installProgram 执行安装流程, 界面和静默模式共用.
+// resume 不为空时继续上次被中断的安装. 返回可选步骤失败产生的警告.
+func installProgram(ic *InstallContext, resume *Journal) ([]*StepError, error) {
+	// 安装程序本身损坏时什么都不做, 继续安装的日志留给下一个完好的安装程序
+	if err := verifyEmbedded(); err != nil {
+		return nil, err
+	}
+
+	journal := resume
+	if journal != nil {
+		prepareResume(journal, ic.InstallPath)
+	} else {
+		var err error
+		journal, err = OpenJournal(JournalPath(), ic.InstallPath, ic.Language)
+		if errors.Is(err, errUnfinishedRollback) {
+			// 旧日志留在磁盘上, 下次启动时再询问回滚
+			return nil, err
+		}
+		if err != nil {
+			slog.Warn("create install journal", "path", JournalPath(), "err", err)
+			journal = NewJournal()
+		}
+	}
+	defer journal.Close()
+	ic.Journal = journal
+
+	m, err := loadManifest()
+	if err != nil {
+		return nil, err
+	}
+	ic.Manifest = m
+
+	pipeline := &Pipeline{Steps: installSteps()}
+	err = pipeline.Run(ic)
+	return pipeline.Warnings, err
+}
+
+// errorMessage 返回给用户看的错误信息, 不带步骤名
+func errorMessage(err error) string {
+	var installErr *InstallError
+	if errors.As(err, &installErr) {
+		return installErr.UserMessage()
+	}
+	switch {
+	case errors.Is(err, ErrCancelled):
+		return Text("Installation cancelled, all changes have been rolled back")
+	case errors.Is(err, ErrTimeout):
+		return Text("The installation took too long and has been rolled back")
+	}
+	var stepErr *StepError
+	if errors.As(err, &stepErr) {
+		return stepErr.Err.Error()
+	}
+	return err.Error()
+}
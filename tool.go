@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/lxn/walk"
+)
+
+// toolReport 卸载、修复等维护操作的结果
+type toolReport struct {
+	InstallPath string
+	Warnings    []*StepError
+	// Done 成功时显示的信息, Details 附加在信息后面, 例如修复的文件
+	Done     string
+	Details  []string
+	Repaired []string
+}
+
+// runTool 执行不需要主窗口的维护操作, 负责语言、提权、显示结果和写结果文件, 返回进程退出码.
+// run 返回 elevateError 时以管理员权限重新运行, 管理员进程会重新确认并自己写结果文件.
+func runTool(opts *Options, title string, run func(report *toolReport) error) int {
+	start := time.Now()
+	if opts.Lang != "" {
+		i18n = InitI18n(opts.Lang)
+	} else {
+		i18n = InitI18n(GetLocale())
+	}
+
+	report := &toolReport{}
+	err := run(report)
+
+	var elevate *elevateError
+	if errors.As(err, &elevate) {
+		if opts.Silent {
+			code, adminErr := runAsAdminWait(os.Args[1:])
+			if adminErr == nil {
+				return int(code)
+			}
+			err = errors.Join(adminErr, err)
+		} else if runAsAdmin(os.Args[1:]) {
+			return ExitSuccess
+		}
+	}
+
+	if opts.Silent {
+		for _, warning := range report.Warnings {
+			fmt.Fprintln(os.Stderr, warning)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		for _, detail := range report.Details {
+			fmt.Println(detail)
+		}
+	} else if err == nil {
+		message := report.Done
+		if len(report.Details) > 0 {
+			message += "\r\n" + strings.Join(report.Details, "\r\n")
+		}
+		walk.MsgBox(nil, Text(title), message, walk.MsgBoxIconInformation|walk.MsgBoxTopMost)
+	} else if !errors.Is(err, ErrCancelled) {
+		message := errorMessage(err)
+		if len(report.Details) > 0 {
+			message += "\r\n" + strings.Join(report.Details, "\r\n")
+		}
+		walk.MsgBox(nil, Text("Error"), message, walk.MsgBoxIconError|walk.MsgBoxTopMost)
+	}
+
+	result := newInstallResult(report.InstallPath, start, err, report.Warnings)
+	result.Repaired = report.Repaired
+	if err := result.Write(opts.ResultFile); err != nil {
+		slog.Error("write result file", "path", opts.ResultFile, "err", err)
+	}
+	return result.ExitCode
+}
+
+// confirmTool 非静默模式下让用户确认维护操作
+func confirmTool(opts *Options, title string, message string) bool {
+	if opts.Silent {
+		return true
+	}
+	return walk.MsgBox(nil, Text(title), message, walk.MsgBoxYesNo|walk.MsgBoxIconQuestion|walk.MsgBoxTopMost) == walk.DlgCmdYes
+}
+
+// rollbackBeforeTool 维护操作之前先回滚被中断的安装
+func rollbackBeforeTool() error {
+	journal, err := LoadJournal(JournalPath())
+	if err != nil {
+		slog.Error("read install journal", "path", JournalPath(), "err", err)
+		return nil
+	}
+	if journal == nil {
+		return nil
+	}
+	return rollbackInterruptedInstall(journal)
+}
+
+// clientProcesses 修改安装目录前必须退出的客户端进程, Steam 不影响
+func clientProcesses() []string {
+	return []string{"GamePower.exe", filepath.Base(guiExePath(""))}
+}
+
+// canWrite 判断当前用户能否修改目录 dir, 目录不存在时视为可以
+func canWrite(dir string) bool {
+	f, err := os.CreateTemp(dir, ".lgt-*")
+	if err != nil {
+		return !errors.Is(err, fs.ErrPermission)
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return true
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// Uninstall 倒序删除清单中的文件和目录, 返回删除失败的条目.
+// 目录中还有清单以外的文件(例如 webcache)时保留目录; purge 为 true 时连同 webcache 和 appdata 目录一起删除.
+// 删除失败的条目留在清单中, 下次卸载时再试.
+func Uninstall(inventory *Inventory, appdataPath string, purge bool) []*InstallError {
+	var errs []*InstallError
+	if purge {
+		webcache := filepath.Join(inventory.InstallPath, "webcache")
+		if err := os.RemoveAll(webcache); err != nil {
+			errs = append(errs, newInstallError(CodeRemoveFile, webcache, err))
+		}
+	}
+
+	var remaining []InventoryEntry
+	for i := len(inventory.Entries) - 1; i >= 0; i-- {
+		entry := inventory.Entries[i]
+		if entry.Dir {
+			if dir, err := os.ReadDir(entry.Path); err == nil && len(dir) > 0 {
+				slog.Info("keep directory", "path", entry.Path)
+				continue
+			}
+		}
+		err := os.Remove(entry.Path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, newInstallError(CodeRemoveFile, entry.Path, err))
+			remaining = append([]InventoryEntry{entry}, remaining...)
+		}
+	}
+
+	// 安装目录可能在安装前就已经存在而没有记录, 空了也一并删除
+	if dir, err := os.ReadDir(inventory.InstallPath); err == nil && len(dir) == 0 {
+		os.Remove(inventory.InstallPath)
+	}
+
+	if len(errs) > 0 {
+		inventory.Entries = remaining
+		if err := inventory.Save(InventoryPath()); err != nil {
+			slog.Error("save install inventory", "path", InventoryPath(), "err", err)
+		}
+		return errs
+	}
+
+	if purge {
+		closeLogFile()
+		if err := os.RemoveAll(appdataPath); err != nil {
+			errs = append(errs, newInstallError(CodeRemoveFile, appdataPath, err))
+		}
+	} else if err := os.Remove(InventoryPath()); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		errs = append(errs, newInstallError(CodeRemoveFile, InventoryPath(), err))
+	}
+	return errs
+}
+
+// runUninstall 执行 --uninstall, 返回进程退出码
+func runUninstall(opts *Options) int {
+	return runTool(opts, TextKey("Uninstall"), func(report *toolReport) error {
+		// 被中断的安装先回滚, 它创建的文件还没有写进清单
+		if err := rollbackBeforeTool(); err != nil {
+			return err
+		}
+
+		inventory, err := LoadInventory(InventoryPath())
+		if err != nil {
+			return err
+		}
+		if inventory == nil {
+			// 旧版本安装时没有清单, 按内嵌压缩包的清单推算安装的文件
+			installPath := opts.Path
+			if installPath == "" {
+				installPath = defaultInstallPath()
+			}
+			if !FileExists(guiExePath(installPath)) {
+				return newInstallError(CodeNotInstalled, installPath, nil)
+			}
+			ic := newInstallContext(installPath, i18n)
+			if ic.Manifest, err = loadManifest(); err != nil {
+				return err
+			}
+			inventory = manifestInventory(ic)
+		}
+		report.InstallPath = inventory.InstallPath
+
+		if !IsAdmin() && !canWrite(inventory.InstallPath) {
+			return &elevateError{newInstallError(CodeRemoveFile, inventory.InstallPath, fs.ErrPermission)}
+		}
+		if !confirmTool(opts, TextKey("Uninstall"), Textf("Remove LuckyGameTools from {dir}?", "dir", inventory.InstallPath)) {
+			return ErrCancelled
+		}
+		for _, process := range clientProcesses() {
+			if IsRuning(process) {
+				return newInstallError(CodeClientRunning, process, nil)
+			}
+		}
+
+		failures := Uninstall(inventory, GetMyAppdataFolder(), opts.Purge)
+		if len(failures) == 0 {
+			report.Done = Text("Uninstallation complete")
+			return nil
+		}
+		causes := make([]error, len(failures))
+		for i, failure := range failures {
+			causes[i] = failure
+			report.Details = append(report.Details, failure.Message())
+			report.Warnings = append(report.Warnings, &StepError{Step: "uninstall", Phase: "remove", Err: failure})
+		}
+		return newInstallError(CodeUninstall, inventory.InstallPath, errors.Join(causes...))
+	})
+}